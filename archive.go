@@ -0,0 +1,543 @@
+package csvq
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mithrandie/csvq/lib/option"
+)
+
+// ErrCompressedFileConflict is returned when a committed table cannot be written to the compressed file
+// because the compressed file has been changed since the table was extracted.
+var ErrCompressedFileConflict = errors.New("compressed file has been changed since it was extracted")
+
+// sourceWriteMu serializes the checks and the writes of the compressed files in the os file system.
+var sourceWriteMu sync.Mutex
+
+// ArchiveWriteError is returned when a statement writes to a file in an archive.
+type ArchiveWriteError struct {
+	Archive string
+	Member  string
+}
+
+func NewArchiveWriteError(archive string, member string) error {
+	return &ArchiveWriteError{
+		Archive: archive,
+		Member:  member,
+	}
+}
+
+func (e ArchiveWriteError) Error() string {
+	return fmt.Sprintf("cannot write to %q in archive %q: files in archives are read-only", e.Member, e.Archive)
+}
+
+type archiveFormat int
+
+const (
+	archiveZip archiveFormat = iota
+	archiveTar
+)
+
+// archiveFormatOf reports the format of the archive file name and the codec that the archive is compressed with.
+func archiveFormatOf(name string) (archiveFormat, *Codec, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip, nil, true
+	case strings.HasSuffix(lower, ".tar"):
+		return archiveTar, nil, true
+	case strings.HasSuffix(lower, ".tgz"):
+		codec, _, _ := codecFor("archive.tar.gz")
+		return archiveTar, &codec, true
+	}
+
+	if codec, base, ok := codecFor(name); ok && strings.HasSuffix(strings.ToLower(base), ".tar") {
+		return archiveTar, &codec, true
+	}
+	return 0, nil, false
+}
+
+// splitArchivePath splits the path of a file in an archive into the path of the archive and the name of the file.
+func splitArchivePath(p string) (string, string, bool) {
+	elems := strings.Split(filepath.ToSlash(p), "/")
+	for i := 0; i < len(elems)-1; i++ {
+		if _, _, ok := archiveFormatOf(elems[i]); ok {
+			return filepath.FromSlash(strings.Join(elems[:i+1], "/")), path.Clean(strings.Join(elems[i+1:], "/")), true
+		}
+	}
+	return "", "", false
+}
+
+type extractedFile struct {
+	archive  string
+	member   string
+	location string
+	path     string
+
+	// source holds the state of the archive or the compressed file when the file was extracted or written back.
+	source fileState
+	// extracted holds the state of the extracted file when the file was extracted or written back.
+	extracted fileState
+}
+
+// archiveCache holds the files extracted from archives and compressed files for a connection.
+// csvq reads tables only from plain files, so the files are extracted to a temporary directory
+// and the identifiers in queries are replaced with the paths of the extracted files.
+type archiveCache struct {
+	dir   string
+	files map[string]*extractedFile
+}
+
+func (a *archiveCache) extractedPath(name string) (string, error) {
+	if len(a.dir) < 1 {
+		dir, err := os.MkdirTemp("", "csvq-driver-archive-")
+		if err != nil {
+			return "", err
+		}
+		a.dir = dir
+	}
+	dir := filepath.Join(a.dir, strconv.Itoa(len(a.files)+1))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func (a *archiveCache) lookup(p string) (*extractedFile, bool) {
+	if a == nil || !strings.HasPrefix(p, a.dir+string(filepath.Separator)) {
+		return nil, false
+	}
+	for _, f := range a.files {
+		if f.path == p {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func (a *archiveCache) close() error {
+	if a == nil || len(a.dir) < 1 {
+		return nil
+	}
+	return os.RemoveAll(a.dir)
+}
+
+// rewriteArchivePaths replaces quoted identifiers that refer to files in archives or to compressed files
+// with the paths of the extracted files.
+func (c *Conn) rewriteArchivePaths(queryString string) (string, error) {
+	tokens := tokenizeQuery(queryString, c.proc.Tx.Flags.AnsiQuotes)
+	for i := range tokens {
+		if tokens[i].typ != tokenIdentifier {
+			continue
+		}
+		p, ok, err := c.extractTable(unquoteIdentifier(tokens[i].literal), isCreateTableTarget(tokens, i))
+		if err != nil {
+			return queryString, err
+		}
+		if ok {
+			tokens[i].literal = option.QuoteIdentifier(p)
+		}
+	}
+	return joinQueryTokens(tokens), nil
+}
+
+// isCreateTableTarget reports whether the token at the index is the table name of a CREATE TABLE statement.
+func isCreateTableTarget(tokens []queryToken, idx int) bool {
+	words := make([]string, 0, 5)
+	for i := idx - 1; 0 <= i && len(words) < 5; i-- {
+		switch tokens[i].typ {
+		case tokenWord:
+			words = append(words, strings.ToUpper(tokens[i].literal))
+		case tokenComment:
+			//Do nothing
+		default:
+			if 0 < len(strings.TrimSpace(tokens[i].literal)) {
+				i = -1
+			}
+		}
+	}
+
+	if 2 <= len(words) && words[0] == "TABLE" && words[1] == "CREATE" {
+		return true
+	}
+	return 5 <= len(words) && strings.Join(words, " ") == "EXISTS NOT IF TABLE CREATE"
+}
+
+// extractTable extracts the file that the identifier refers to if the file is in an archive or is compressed,
+// and returns the path of the extracted file.
+// The file is extracted again only if the source file has been modified and the extracted file is not loaded.
+// If create is true and the compressed file does not exist, the path of the file to be created is returned.
+func (c *Conn) extractTable(identifier string, create bool) (string, bool, error) {
+	archive, member, inArchive := splitArchivePath(identifier)
+	if !inArchive {
+		archive = identifier
+		if _, _, ok := codecFor(identifier); !ok {
+			if c.compression == nil || !isTableFile(identifier) || c.sourceExists(identifier) {
+				return "", false, nil
+			}
+			archive = identifier + c.compression.Extensions[0]
+		}
+	}
+
+	location, err := c.sourcePath(archive)
+	if err != nil {
+		return "", false, err
+	}
+	if c.fs == nil || filepath.IsAbs(archive) {
+		if err = c.checkPath(nil, archive); err != nil {
+			return "", false, err
+		}
+	}
+	if c.archives == nil {
+		c.archives = &archiveCache{files: make(map[string]*extractedFile)}
+	}
+	key := location + "\x00" + member
+	extracted, cached := c.archives.files[key]
+
+	f, err := c.openSource(location)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", false, err
+		}
+		if inArchive {
+			return "", false, nil
+		}
+		if cached && extracted.source == (fileState{}) {
+			// The file is created by this connection and has not been committed yet.
+			return extracted.path, true, nil
+		}
+		if !create {
+			return "", false, nil
+		}
+
+		_, name, _ := codecFor(filepath.Base(archive))
+		p, err := c.archives.extractedPath(name)
+		if err != nil {
+			return "", false, err
+		}
+		c.archives.files[key] = &extractedFile{
+			archive:  archive,
+			location: location,
+			path:     p,
+		}
+		return p, true, nil
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	if info.IsDir() {
+		return "", false, nil
+	}
+
+	if cached && (extracted.source == newFileState(info) || c.isLoaded(extracted.path)) {
+		return extracted.path, true, nil
+	}
+
+	var src io.ReadCloser = io.NopCloser(f)
+	name := filepath.Base(archive)
+	if inArchive {
+		if src, name, err = openArchiveMember(f, info, member); err != nil {
+			return "", false, fmt.Errorf("cannot read %q: %w", identifier, err)
+		}
+	}
+	defer func() { _ = src.Close() }()
+
+	var r io.Reader = src
+	if codec, base, ok := codecFor(name); ok {
+		dr, err := codec.newReader(src)
+		if err != nil {
+			return "", false, fmt.Errorf("cannot read %q: %w", identifier, err)
+		}
+		defer func() { _ = dr.Close() }()
+		r = dr
+		name = base
+	}
+
+	if !cached {
+		p, err := c.archives.extractedPath(name)
+		if err != nil {
+			return "", false, err
+		}
+		extracted = &extractedFile{
+			archive:  archive,
+			member:   member,
+			location: location,
+			path:     p,
+		}
+	}
+	if err = writeExtractedFile(extracted.path, r); err != nil {
+		return "", false, fmt.Errorf("cannot read %q: %w", identifier, err)
+	}
+	extractedInfo, err := os.Stat(extracted.path)
+	if err != nil {
+		return "", false, err
+	}
+	extracted.source = newFileState(info)
+	extracted.extracted = newFileState(extractedInfo)
+	c.archives.files[key] = extracted
+	return extracted.path, true, nil
+}
+
+// sourcePath returns the path of the file in the file system of the connection if the connection has one,
+// otherwise the path in the os file system.
+func (c *Conn) sourcePath(name string) (string, error) {
+	if c.fs != nil && !filepath.IsAbs(name) {
+		p := path.Clean(filepath.ToSlash(name))
+		if !fs.ValidPath(p) {
+			return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+		}
+		return c.fs.fsPath(p), nil
+	}
+
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+	repository, err := repositoryPath(c.proc.Tx.Flags)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(repository, name), nil
+}
+
+func (c *Conn) sourceExists(name string) bool {
+	p, err := c.sourcePath(name)
+	if err != nil {
+		return false
+	}
+	f, err := c.openSource(p)
+	if err != nil {
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+// openSource opens the file at the path returned by sourcePath.
+func (c *Conn) openSource(p string) (fs.File, error) {
+	if c.fs != nil && !filepath.IsAbs(p) {
+		return c.fs.fsys.Open(p)
+	}
+	return os.Open(p)
+}
+
+// writeSource writes the file at the path returned by sourcePath.
+// Files in the os file system are replaced atomically.
+// check is called just before the file is replaced, and the file is not written if check returns an error.
+func (c *Conn) writeSource(p string, check func() error, write func(w io.Writer) error) error {
+	if c.fs != nil && !filepath.IsAbs(p) {
+		wfs, ok := c.fs.fsys.(WritableFS)
+		if !ok {
+			return ErrReadOnlyFS
+		}
+		buf := &bytes.Buffer{}
+		if err := write(buf); err != nil {
+			return err
+		}
+
+		c.fs.mu.Lock()
+		defer c.fs.mu.Unlock()
+		if err := check(); err != nil {
+			return err
+		}
+		return wfs.WriteFile(p, buf.Bytes(), 0644)
+	}
+
+	sourceWriteMu.Lock()
+	defer sourceWriteMu.Unlock()
+	return writeFileAtomically(p, write, check)
+}
+
+// sourceState returns the state of the file at the path returned by sourcePath.
+// If the file does not exist, the zero value is returned.
+func (c *Conn) sourceState(p string) (fileState, error) {
+	f, err := c.openSource(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fileState{}, nil
+		}
+		return fileState{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileState{}, err
+	}
+	return newFileState(info), nil
+}
+
+// openArchiveMember opens the file in the archive, and returns the name of the file.
+// As with tables, the extension of the file name can be omitted.
+func openArchiveMember(f fs.File, info fs.FileInfo, member string) (io.ReadCloser, string, error) {
+	format, codec, _ := archiveFormatOf(info.Name())
+
+	candidates := []string{member}
+	if len(path.Ext(member)) < 1 {
+		for _, ext := range tableExtensions {
+			candidates = append(candidates, member+ext)
+		}
+	}
+	match := func(name string) bool {
+		name = path.Clean(name)
+		for _, c := range candidates {
+			if name == c {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch format {
+	case archiveZip:
+		ra, ok := f.(io.ReaderAt)
+		if !ok {
+			b, err := io.ReadAll(f)
+			if err != nil {
+				return nil, "", err
+			}
+			ra = bytes.NewReader(b)
+		}
+		zr, err := zip.NewReader(ra, info.Size())
+		if err != nil {
+			return nil, "", err
+		}
+		for _, zf := range zr.File {
+			if !zf.FileInfo().IsDir() && match(zf.Name) {
+				r, err := zf.Open()
+				return r, path.Base(zf.Name), err
+			}
+		}
+	default:
+		var r io.Reader = f
+		if codec != nil {
+			cr, err := codec.newReader(f)
+			if err != nil {
+				return nil, "", err
+			}
+			defer func() { _ = cr.Close() }()
+			r = cr
+		}
+		tr := tar.NewReader(r)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if h.Typeflag == tar.TypeReg && match(h.Name) {
+				b, err := io.ReadAll(tr)
+				return io.NopCloser(bytes.NewReader(b)), path.Base(h.Name), err
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("file %q is not found in the archive", member)
+}
+
+func writeExtractedFile(p string, r io.Reader) error {
+	fp, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fp, r); err != nil {
+		_ = fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// checkArchiveWrites returns an ArchiveWriteError if the transaction has changes to files in archives,
+// or an error if the transaction has changes to compressed files that cannot be compressed.
+func (c *Conn) checkArchiveWrites() error {
+	if c.archives == nil {
+		return nil
+	}
+	for _, p := range uncommittedFiles(c.proc.Tx) {
+		f, ok := c.archives.lookup(p)
+		if !ok {
+			continue
+		}
+		if 0 < len(f.member) {
+			return NewArchiveWriteError(f.archive, f.member)
+		}
+		codec, _, _ := codecFor(f.archive)
+		if err := codec.checkWriter(); err != nil {
+			return fmt.Errorf("cannot write to %q: %w", f.archive, err)
+		}
+	}
+	return nil
+}
+
+// syncCompressedFiles compresses the committed changes of the files extracted from compressed files,
+// and replaces the compressed files.
+// If a compressed file has been changed since the file was extracted, the compressed file is not overwritten,
+// the extracted file is discarded so that it is extracted again, and ErrCompressedFileConflict is returned.
+func (c *Conn) syncCompressedFiles() error {
+	if c.archives == nil {
+		return nil
+	}
+
+	var conflicts []string
+	for key, f := range c.archives.files {
+		if 0 < len(f.member) || c.isUncommitted(f.path) {
+			continue
+		}
+		info, err := os.Stat(f.path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if newFileState(info) == f.extracted {
+			continue
+		}
+
+		unchanged := func() error {
+			state, err := c.sourceState(f.location)
+			if err != nil {
+				return err
+			}
+			if state != f.source {
+				return ErrCompressedFileConflict
+			}
+			return nil
+		}
+
+		codec, _, _ := codecFor(f.archive)
+		if err = c.writeSource(f.location, unchanged, compressFile(codec, f.path)); err != nil {
+			if errors.Is(err, ErrCompressedFileConflict) {
+				_ = c.proc.Tx.CachedViews.Dispose(c.proc.Tx.FileContainer, strings.ToUpper(f.path))
+				_ = os.Remove(f.path)
+				delete(c.archives.files, key)
+				conflicts = append(conflicts, strconv.Quote(f.archive))
+				continue
+			}
+			return fmt.Errorf("cannot write to %q: %w", f.archive, err)
+		}
+
+		if f.source, err = c.sourceState(f.location); err != nil {
+			return err
+		}
+		f.extracted = newFileState(info)
+	}
+	if 0 < len(conflicts) {
+		return fmt.Errorf("cannot write to %s: %w", strings.Join(conflicts, ", "), ErrCompressedFileConflict)
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+package csvq
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func createArchiveFiles(dir string, srcfile string) error {
+	b, err := os.ReadFile(srcfile)
+	if err != nil {
+		return err
+	}
+
+	zb := &bytes.Buffer{}
+	zw := zip.NewWriter(zb)
+	for _, name := range []string{"table.csv", "nested/table.csv"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(dir, "archive.zip"), zb.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	tb := &bytes.Buffer{}
+	gw := gzip.NewWriter(tb)
+	tw := tar.NewWriter(gw)
+	if err = tw.WriteHeader(&tar.Header{Name: "table.csv", Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	if _, err = tw.Write(b); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(dir, "archive.tar.gz"), tb.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	gb := &bytes.Buffer{}
+	gw = gzip.NewWriter(gb)
+	if _, err = gw.Write(b); err != nil {
+		return err
+	}
+	if err = gw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "table.csv.gz"), gb.Bytes(), 0644)
+}
+
+var archiveTests = []struct {
+	Name  string
+	Query string
+	Error string
+}{
+	{
+		Name:  "File in Zip Archive",
+		Query: "SELECT col1, col2 FROM `archive.zip/table.csv`",
+	},
+	{
+		Name:  "File in Directory of Zip Archive without Extension",
+		Query: "SELECT col1, col2 FROM `archive.zip/nested/table`",
+	},
+	{
+		Name:  "File in Tar Archive Compressed with Gzip",
+		Query: "SELECT col1, col2 FROM `archive.tar.gz/table.csv`",
+	},
+	{
+		Name:  "File Compressed with Gzip",
+		Query: "SELECT col1, col2 FROM `table.csv.gz`",
+	},
+	{
+		Name:  "File Compressed with Bzip2",
+		Query: "SELECT `table`.col1, `table`.col2 FROM `table.csv.bz2`",
+	},
+	{
+		Name:  "File Compressed with Zstd",
+		Query: "SELECT `table`.col1, `table`.col2 FROM `table.csv.zst`",
+	},
+	{
+		Name:  "File Not Found in Archive",
+		Query: "SELECT col1, col2 FROM `archive.zip/notexist.csv`",
+		Error: "cannot read \"archive.zip/notexist.csv\": file \"notexist.csv\" is not found in the archive",
+	},
+}
+
+func TestArchive(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, err := sql.Open("csvq", ArchiveTestDir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := [][]interface{}{
+		{1, "str1"},
+		{2, "str2"},
+		{3, "str3"},
+	}
+
+	for _, v := range archiveTests {
+		err := matchRows(ctx, db, expect, v.Query)
+		if err != nil {
+			if len(v.Error) < 1 {
+				t.Errorf("%s: unexpected error %q", v.Name, err.Error())
+			} else if err.Error() != v.Error {
+				t.Errorf("%s: error %q, want error %q", v.Name, err.Error(), v.Error)
+			}
+			continue
+		}
+		if 0 < len(v.Error) {
+			t.Errorf("%s: no error, want error %q", v.Name, v.Error)
+		}
+	}
+}
+
+func TestArchive_Write(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, err := sql.Open("csvq", ArchiveTestDir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	_, err = db.ExecContext(ctx, "UPDATE `archive.zip/table.csv` SET col2 = 'updated' WHERE col1 = 1")
+	if err == nil {
+		t.Fatal("no error, want ArchiveWriteError")
+	}
+	var writeErr *ArchiveWriteError
+	if !errors.As(err, &writeErr) {
+		t.Fatalf("error %#v, want ArchiveWriteError", err)
+	}
+	if writeErr.Archive != "archive.zip" || writeErr.Member != "table.csv" {
+		t.Errorf("error = %#v, want archive %q and member %q", writeErr, "archive.zip", "table.csv")
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO `table.csv.bz2` VALUES (4, 'str4')")
+	if err == nil || err.Error() != "cannot write to \"table.csv.bz2\": bzip2 compression is not available: register an implementation with RegisterCodec" {
+		t.Errorf("error %v, want an error for the codec that does not support compression", err)
+	}
+
+	var col2 string
+	if err := db.QueryRowContext(ctx, "SELECT col2 FROM `archive.zip/table.csv` WHERE col1 = 1").Scan(&col2); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if col2 != "str1" {
+		t.Errorf("col2 = %q, want %q", col2, "str1")
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	RegisterCodec(Codec{
+		Name:       "reverse",
+		Extensions: []string{".rev"},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			b, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+				b[i], b[j] = b[j], b[i]
+			}
+			return io.NopCloser(bytes.NewReader(b)), nil
+		},
+	})
+
+	RegisterCodec(Codec{
+		Name:       "noreader",
+		Extensions: []string{".nr"},
+	})
+
+	fsys := fstest.MapFS{
+		"data/table.csv.rev": &fstest.MapFile{Data: []byte("2rts,2\n1rts,1\n2loc,1loc")},
+		"data/table.csv.nr":  &fstest.MapFile{Data: []byte("col1,col2\n1,str1\n")},
+	}
+	db := sql.OpenDB(NewConnector("data", WithFS(fsys)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := [][]interface{}{
+		{1, "str1"},
+		{2, "str2"},
+	}
+	if err := matchRows(ctx, db, expect, "SELECT col1, col2 FROM `table.csv.rev`"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectErr := "cannot read \"table.csv.nr\": noreader decompression is not available: register an implementation with RegisterCodec"
+	if _, err := db.ExecContext(ctx, "SELECT col1, col2 FROM `table.csv.nr`"); err == nil || err.Error() != expectErr {
+		t.Errorf("error %v, want error %q", err, expectErr)
+	}
+}
+
+func TestDescribeTable_Archive(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, err := sql.Open("csvq", ArchiveTestDir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	info, err := DescribeTable(ctx, conn, "archive.zip/table.csv")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if info.Name != "archive.zip/table.csv" || !strings.HasSuffix(info.Path, "table.csv") {
+		t.Errorf("table = %#v, want the file extracted from the archive", info)
+	}
+
+	columns := make([]string, 0, len(info.Columns))
+	for _, c := range info.Columns {
+		columns = append(columns, c.Name)
+	}
+	if !reflect.DeepEqual(columns, []string{"col1", "col2"}) {
+		t.Errorf("columns = %q, want %q", columns, []string{"col1", "col2"})
+	}
+}
+
+func readGzipFile(name string) (string, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = fp.Close() }()
+
+	r, err := gzip.NewReader(fp)
+	if err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
+
+func TestCompressedWrite(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := t.TempDir()
+	db, err := sql.Open("csvq", dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if _, err = db.ExecContext(ctx, "CREATE TABLE `new.csv.gz` (col1, col2); INSERT INTO `new.csv.gz` VALUES (1, 'str1');"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	expect := "col1,col2\n1,str1\n"
+	if s, err := readGzipFile(filepath.Join(dir, "new.csv.gz")); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	} else if s != expect {
+		t.Errorf("content = %q, want %q", s, expect)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, err = tx.ExecContext(ctx, "INSERT INTO `new.csv.gz` VALUES (2, 'str2')"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if s, err := readGzipFile(filepath.Join(dir, "new.csv.gz")); err != nil || s != expect {
+		t.Errorf("content = %q, want %q before the transaction is committed", s, expect)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	expect = "col1,col2\n1,str1\n2,str2\n"
+	if s, err := readGzipFile(filepath.Join(dir, "new.csv.gz")); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	} else if s != expect {
+		t.Errorf("content = %q, want %q", s, expect)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"new.csv.gz"}) {
+		t.Errorf("files = %q, want %q", names, []string{"new.csv.gz"})
+	}
+}
+
+func TestCompressedWrite_Conflict(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := t.TempDir()
+	db, err := sql.Open("csvq", dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if _, err = db.ExecContext(ctx, "CREATE TABLE `new.csv.gz` (col1, col2); INSERT INTO `new.csv.gz` VALUES (1, 'str1');"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, err = tx.ExecContext(ctx, "INSERT INTO `new.csv.gz` VALUES (2, 'str2')"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	// Another writer replaces the compressed file before the transaction is committed.
+	written := "col1,col2\n1,str1\n3,str3\n"
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	_, _ = gw.Write([]byte(written))
+	_ = gw.Close()
+	if err = os.WriteFile(filepath.Join(dir, "new.csv.gz"), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	if err = tx.Commit(); !errors.Is(err, ErrCompressedFileConflict) {
+		t.Fatalf("error = %v, want ErrCompressedFileConflict", err)
+	}
+	if s, err := readGzipFile(filepath.Join(dir, "new.csv.gz")); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	} else if s != written {
+		t.Errorf("content = %q, want %q", s, written)
+	}
+
+	expect := [][]interface{}{
+		{1, "str1"},
+		{3, "str3"},
+	}
+	if err = matchRows(ctx, db, expect, "SELECT INTEGER(col1), col2 FROM `new.csv.gz`"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressedWrite_Compression(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := t.TempDir()
+	db, err := sql.Open("csvq", dir+"?compression=gzip")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if _, err = db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `out.csv` (col1, col2)"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, err = db.ExecContext(ctx, "INSERT INTO `out.csv` VALUES (1, 'str1')"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	expect := "col1,col2\n1,str1\n"
+	if s, err := readGzipFile(filepath.Join(dir, "out.csv.gz")); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	} else if s != expect {
+		t.Errorf("content = %q, want %q", s, expect)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.csv")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("uncompressed file exists")
+	}
+
+	var col2 string
+	if err := db.QueryRowContext(ctx, "SELECT col2 FROM `out.csv` WHERE col1 = 1").Scan(&col2); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if col2 != "str1" {
+		t.Errorf("col2 = %q, want %q", col2, "str1")
+	}
+}
+
+func TestCompressedWrite_InvalidCompression(t *testing.T) {
+	db, err := sql.Open("csvq", ArchiveTestDir+"?compression=bzip2")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := "invalid compression \"bzip2\": bzip2 compression is not available: register an implementation with RegisterCodec"
+	if err := db.Ping(); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+}
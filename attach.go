@@ -0,0 +1,222 @@
+package csvq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// ReadOnlyRepositoryError is returned when a statement writes to a file in a repository attached as read-only.
+type ReadOnlyRepositoryError struct {
+	Schema string
+	Path   string
+}
+
+func NewReadOnlyRepositoryError(schema string, path string) error {
+	return &ReadOnlyRepositoryError{
+		Schema: schema,
+		Path:   path,
+	}
+}
+
+func (e ReadOnlyRepositoryError) Error() string {
+	return fmt.Sprintf("cannot write to %q in repository %q: the repository is attached as read-only", e.Path, e.Schema)
+}
+
+// attachment is a repository attached to a connection under a schema name.
+// Tables in the repository are referred to by the names qualified by the schema name, such as "ref.countries".
+type attachment struct {
+	schema   string
+	dir      string
+	readOnly bool
+}
+
+// parseAttachment parses the value of the DSN parameters "Attach" and "AttachReadOnly", such as "ref:/path/to/ref".
+func parseAttachment(s string, readOnly bool) (attachment, error) {
+	i := strings.IndexRune(s, ':')
+	if i < 0 {
+		return attachment{}, fmt.Errorf("repository must be specified as \"schema:path\"")
+	}
+	a := attachment{
+		schema:   s[:i],
+		dir:      s[i+1:],
+		readOnly: readOnly,
+	}
+	return a, a.validate()
+}
+
+func (a attachment) validate() error {
+	if len(a.schema) < 1 {
+		return fmt.Errorf("schema name is empty")
+	}
+	for _, r := range a.schema {
+		if !isWordRune(r) {
+			return fmt.Errorf("schema name %q must consist of letters, digits and underscores", a.schema)
+		}
+	}
+	if isInformationSchema(a.schema) {
+		return fmt.Errorf("schema name %q is reserved", a.schema)
+	}
+	if len(a.dir) < 1 {
+		return fmt.Errorf("path of schema %q is empty", a.schema)
+	}
+	return nil
+}
+
+// attachRepositories returns the repositories attached by the data source name and WithAttachedRepository
+// with their directories resolved. Each schema name can be attached once.
+func attachRepositories(attachments []attachment, options *connectorOptions) ([]attachment, error) {
+	attachments = append(append([]attachment(nil), attachments...), options.attachments...)
+	if len(attachments) < 1 {
+		return nil, nil
+	}
+
+	schemas := make(map[string]bool)
+	for i := range attachments {
+		a := &attachments[i]
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("invalid attached repository: %w", err)
+		}
+		if schemas[strings.ToUpper(a.schema)] {
+			return nil, fmt.Errorf("invalid attached repository: schema %q is attached more than once", a.schema)
+		}
+		schemas[strings.ToUpper(a.schema)] = true
+
+		dir, err := evalPath(a.dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attached repository %q: %w", a.dir, err)
+		}
+		stat, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attached repository %q: %w", a.dir, err)
+		}
+		if !stat.IsDir() {
+			return nil, fmt.Errorf("invalid attached repository %q: not a directory", a.dir)
+		}
+		a.dir = dir
+	}
+	return attachments, nil
+}
+
+func attachmentDirs(attachments []attachment) []string {
+	dirs := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		dirs = append(dirs, a.dir)
+	}
+	return dirs
+}
+
+func (c *Conn) attachment(schema string) (attachment, bool) {
+	for _, a := range c.attachments {
+		if strings.EqualFold(a.schema, schema) {
+			return a, true
+		}
+	}
+	return attachment{}, false
+}
+
+// attachedTable returns the attached repository and the table name if the name is qualified by an attached schema.
+func (c *Conn) attachedTable(name string) (attachment, string, bool) {
+	i := strings.IndexRune(name, '.')
+	if i < 0 {
+		return attachment{}, "", false
+	}
+	a, ok := c.attachment(name[:i])
+	return a, name[i+1:], ok
+}
+
+// rewriteAttachedTables replaces the table names qualified by the attached schemas with the paths of the files.
+// Tables in FROM clauses are given the unqualified names as their aliases.
+// Qualified names that are not tables, such as column names qualified by table aliases, are not replaced.
+func (c *Conn) rewriteAttachedTables(queryString string) string {
+	if len(c.attachments) < 1 {
+		return queryString
+	}
+
+	ansiQuotes := c.proc.Tx.Flags.AnsiQuotes
+	tokens := tokenizeQuery(queryString, ansiQuotes)
+
+	// Qualified names are quoted so that the query string can be parsed, and the original literals are kept
+	// to restore the names that are not tables.
+	qualified := make(map[int]string)
+	rewritten := make([]queryToken, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.typ == tokenWord && i+2 < len(tokens) && tokens[i+1].literal == "." && (i < 1 || tokens[i-1].literal != ".") {
+			if _, ok := c.attachment(t.literal); ok {
+				var name string
+				switch tokens[i+2].typ {
+				case tokenWord:
+					name = tokens[i+2].literal
+				case tokenIdentifier:
+					name = unquoteIdentifier(tokens[i+2].literal)
+				}
+
+				if 0 < len(name) {
+					qualified[len(rewritten)] = t.literal + tokens[i+1].literal + tokens[i+2].literal
+					rewritten = append(rewritten, queryToken{
+						typ:     tokenIdentifier,
+						literal: option.QuoteIdentifier(t.literal + "." + name),
+					})
+					i += 2
+					continue
+				}
+			}
+		}
+		rewritten = append(rewritten, t)
+	}
+	if len(qualified) < 1 {
+		return queryString
+	}
+
+	statements, _, err := parser.Parse(joinQueryTokens(rewritten), "", true, ansiQuotes)
+	if err != nil {
+		// Syntax errors are reported when the query string is parsed again.
+		return queryString
+	}
+	positions := c.tablePositions(statements, func(name string) bool {
+		_, _, ok := c.attachedTable(name)
+		return ok
+	}, true)
+
+	forEachTablePosition(rewritten, positions, func(i int, canBeAliased bool) {
+		if _, ok := qualified[i]; !ok {
+			return
+		}
+		a, name, _ := c.attachedTable(unquoteIdentifier(rewritten[i].literal))
+		rewritten[i].literal = option.QuoteIdentifier(filepath.Join(a.dir, name))
+		if canBeAliased {
+			rewritten[i].literal += " AS " + option.QuoteIdentifier(query.FormatTableName(name))
+		}
+		delete(qualified, i)
+	})
+	for i, literal := range qualified {
+		rewritten[i].literal = literal
+	}
+	return joinQueryTokens(rewritten)
+}
+
+// checkAttachedWrites returns a ReadOnlyRepositoryError if the transaction has changes to files in the repositories
+// attached as read-only.
+func (c *Conn) checkAttachedWrites() error {
+	for _, a := range c.attachments {
+		if !a.readOnly {
+			continue
+		}
+		for _, p := range uncommittedFiles(c.proc.Tx) {
+			evaluated, err := evalPath(p)
+			if err != nil {
+				return err
+			}
+			if isInDirectory(evaluated, a.dir) {
+				return NewReadOnlyRepositoryError(a.schema, p)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupAttachDirs(t *testing.T) (string, string, string) {
+	dir := t.TempDir()
+	repository := filepath.Join(dir, "repository")
+	ref := filepath.Join(dir, "ref")
+	work := filepath.Join(dir, "work")
+	for _, d := range []string{repository, ref, work} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(repository, "users.csv"): "id,name,country\n1,str1,JP\n2,str2,US\n",
+		filepath.Join(ref, "countries.csv"):    "code,name\nJP,Japan\nUS,United States\n",
+	}
+	for p, content := range files {
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repository, ref, work
+}
+
+func TestAttachedRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	repository, ref, work := setupAttachDirs(t)
+	db, err := sql.Open("csvq", repository+"?AttachReadOnly=ref:"+ref)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	queries := []struct {
+		Query  string
+		Expect [][]interface{}
+	}{
+		{
+			Query:  "SELECT users.id, countries.name FROM ref.countries JOIN users ON countries.code = users.country",
+			Expect: [][]interface{}{{1, "Japan"}, {2, "United States"}},
+		},
+		{
+			Query:  "SELECT ref.id, c.name FROM users ref JOIN REF.`countries.csv` c ON c.code = ref.country",
+			Expect: [][]interface{}{{1, "Japan"}, {2, "United States"}},
+		},
+	}
+	for _, v := range queries {
+		if err := matchRows(ctx, db, v.Expect, v.Query); err != nil {
+			t.Errorf("%s: %s", v.Query, err)
+		}
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO ref.countries VALUES ('FR', 'France')")
+	var roErr *ReadOnlyRepositoryError
+	if !errors.As(err, &roErr) {
+		t.Fatalf("error = %v, want ReadOnlyRepositoryError", err)
+	}
+	if expect := "cannot write to \"" + filepath.Join(ref, "countries.csv") + "\" in repository \"ref\": the repository is attached as read-only"; err.Error() != expect {
+		t.Errorf("error = %q, want error %q", err.Error(), expect)
+	}
+	if err := matchRows(ctx, db, [][]interface{}{{2, "JP"}}, "SELECT COUNT(*), MIN(code) FROM ref.countries"); err != nil {
+		t.Error(err)
+	}
+
+	db2 := sql.OpenDB(NewConnector(repository, WithAttachedRepository("work", work, false)))
+	defer func() {
+		_ = db2.Close()
+	}()
+	statements := []string{
+		"CREATE TABLE work.`summary.csv` (id, name)",
+		"INSERT INTO work.summary SELECT id, name FROM users",
+	}
+	for _, s := range statements {
+		if _, err := db2.ExecContext(ctx, s); err != nil {
+			t.Fatalf("%s: unexpected error %q", s, err.Error())
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(work, "summary.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "id,name\n1,str1\n2,str2\n"; string(b) != expect {
+		t.Errorf("file content = %q, want %q", string(b), expect)
+	}
+}
+
+func TestAttachedRepository_Invalid(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	repository, ref, _ := setupAttachDirs(t)
+	tests := []struct {
+		Name    string
+		Options []ConnectorOption
+		Error   string
+	}{
+		{
+			Name:    "Reserved Schema",
+			Options: []ConnectorOption{WithAttachedRepository("information_schema", ref, true)},
+			Error:   "invalid attached repository: schema name \"information_schema\" is reserved",
+		},
+		{
+			Name:    "Duplicate Schema",
+			Options: []ConnectorOption{WithAttachedRepository("ref", ref, true), WithAttachedRepository("REF", ref, false)},
+			Error:   "invalid attached repository: schema \"REF\" is attached more than once",
+		},
+		{
+			Name:    "Not Directory",
+			Options: []ConnectorOption{WithAttachedRepository("ref", filepath.Join(ref, "countries.csv"), true)},
+			Error:   "invalid attached repository \"" + filepath.Join(ref, "countries.csv") + "\": not a directory",
+		},
+	}
+
+	for _, v := range tests {
+		t.Run(v.Name, func(t *testing.T) {
+			db := sql.OpenDB(NewConnector(repository, v.Options...))
+			defer func() {
+				_ = db.Close()
+			}()
+
+			err := db.PingContext(ctx)
+			if err == nil {
+				t.Fatal("no error, want error")
+			}
+			if err.Error() != v.Error {
+				t.Errorf("error = %q, want error %q", err.Error(), v.Error)
+			}
+		})
+	}
+}
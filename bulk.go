@@ -0,0 +1,326 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+const OperationBulkInsert = "bulk_insert"
+
+const DefaultBulkInsertBatchSize = 1000
+
+// RowSource provides the rows inserted by BulkInsert.
+type RowSource interface {
+	// Next prepares the next row. It returns false when there are no more rows.
+	Next() bool
+
+	// Values returns the values of the current row.
+	// An error returned by Values is reported as an error of the row.
+	Values() ([]interface{}, error)
+
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+}
+
+type sliceRows struct {
+	rows  [][]interface{}
+	index int
+}
+
+// RowsFromSlice returns a RowSource that provides the rows in the slice.
+func RowsFromSlice(rows [][]interface{}) RowSource {
+	return &sliceRows{rows: rows, index: -1}
+}
+
+func (r *sliceRows) Next() bool {
+	r.index++
+	return r.index < len(r.rows)
+}
+
+func (r *sliceRows) Values() ([]interface{}, error) {
+	return r.rows[r.index], nil
+}
+
+func (r *sliceRows) Err() error {
+	return nil
+}
+
+type channelRows struct {
+	ch      <-chan []interface{}
+	current []interface{}
+	err     error
+}
+
+// RowsFromChannel returns a RowSource that provides the rows received from the channel until the channel is closed.
+// BulkInsert stops waiting for the rows when its context is done.
+func RowsFromChannel(ch <-chan []interface{}) RowSource {
+	return &channelRows{ch: ch}
+}
+
+func (r *channelRows) Next() bool {
+	return r.nextContext(context.Background())
+}
+
+func (r *channelRows) nextContext(ctx context.Context) bool {
+	select {
+	case row, ok := <-r.ch:
+		r.current = row
+		return ok
+	case <-ctx.Done():
+		r.err = ctx.Err()
+		return false
+	}
+}
+
+func (r *channelRows) Values() ([]interface{}, error) {
+	return r.current, nil
+}
+
+func (r *channelRows) Err() error {
+	return r.err
+}
+
+// contextRowSource is a RowSource that stops waiting for the next row when the context is done.
+type contextRowSource interface {
+	nextContext(ctx context.Context) bool
+}
+
+type BulkInsertOptions struct {
+	// BatchSize is the number of rows inserted by a statement. The default is DefaultBulkInsertBatchSize.
+	BatchSize int
+
+	// SkipInvalidRows makes BulkInsert skip the rows that cannot be inserted and report them in the result
+	// instead of stopping the insertion.
+	SkipInvalidRows bool
+
+	// Progress is called with the number of the inserted rows each time a batch is inserted.
+	Progress func(inserted int64)
+}
+
+type BulkInsertResult struct {
+	RowsInserted int64
+
+	// Errors holds the errors of the skipped rows when SkipInvalidRows is true.
+	Errors []*RowError
+}
+
+type RowError struct {
+	Row int
+	Err error
+}
+
+func NewRowError(row int, err error) error {
+	return &RowError{
+		Row: row,
+		Err: err,
+	}
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err.Error())
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// BulkInsert inserts the rows into the table in batches and writes the table once.
+// In auto-commit mode, the rows are committed at the end and all rows are discarded if an error occurs.
+// In a transaction, the inserted rows are committed or rolled back with the transaction.
+func (c *Conn) BulkInsert(ctx context.Context, table string, columns []string, rows RowSource, options *BulkInsertOptions) (result BulkInsertResult, err error) {
+	if c.proc == nil {
+		return result, driver.ErrBadConn
+	}
+	if len(columns) < 1 {
+		return result, errors.New("no columns are specified")
+	}
+
+	opts := BulkInsertOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBulkInsertBatchSize
+	}
+
+	queryString := fmt.Sprintf("INSERT INTO %s (%s) VALUES ...", option.QuoteIdentifier(table), quoteIdentifiers(columns))
+	stats := &executionStats{}
+	ctx, obs := startObservation(ctx, c.options, OperationBulkInsert, queryString, c.proc.Tx.Flags.Repository, nil)
+	defer func() {
+		c.proc.Tx.SelectedViews = nil
+		c.proc.Tx.AffectedRows = int(result.RowsInserted)
+		obs.finish(ctx, c.proc.Tx, stats, err)
+	}()
+
+	insertQuery, err := c.bulkInsertQuery(ctx, table, columns)
+	if err != nil {
+		return result, err
+	}
+	obs.setStatements([]parser.Statement{insertQuery})
+	newInsertQuery := func(values []parser.QueryExpression) parser.InsertQuery {
+		q := insertQuery
+		q.ValuesList = values
+		return q
+	}
+
+	autoCommit := c.proc.Tx.AutoCommit
+	c.proc.Tx.AutoCommit = false
+	defer func() {
+		c.proc.Tx.AutoCommit = autoCommit
+		if err != nil && autoCommit {
+			_ = c.proc.AutoRollback()
+			result.RowsInserted = 0
+		}
+	}()
+
+	batch := make([]parser.QueryExpression, 0, opts.BatchSize)
+	insertBatch := func() error {
+		if len(batch) < 1 {
+			return nil
+		}
+		s, err := executeStatements(query.ContextForStoringResults(ctx), c, c.proc, []parser.Statement{newInsertQuery(batch)})
+		if s != nil {
+			stats.rowsScanned += s.rowsScanned
+			stats.bytesRead += s.bytesRead
+		}
+		if err != nil {
+			return err
+		}
+		result.RowsInserted += int64(c.proc.Tx.AffectedRows)
+		batch = batch[:0]
+		if opts.Progress != nil {
+			opts.Progress(result.RowsInserted)
+		}
+		return nil
+	}
+
+	next := rows.Next
+	if r, ok := rows.(contextRowSource); ok {
+		next = func() bool {
+			return r.nextContext(ctx)
+		}
+	}
+
+	for row := 1; next(); row++ {
+		if err = ctx.Err(); err != nil {
+			return result, query.ConvertContextError(err)
+		}
+
+		value, rowErr := bulkInsertRowValue(rows, len(columns))
+		if rowErr != nil {
+			rowErr = NewRowError(row, rowErr)
+			if !opts.SkipInvalidRows {
+				return result, rowErr
+			}
+			result.Errors = append(result.Errors, rowErr.(*RowError))
+			continue
+		}
+
+		batch = append(batch, value)
+		if opts.BatchSize <= len(batch) {
+			if err = insertBatch(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		if ctx.Err() != nil {
+			return result, query.ConvertContextError(ctx.Err())
+		}
+		return result, err
+	}
+	if err = insertBatch(); err != nil {
+		return result, err
+	}
+
+	if autoCommit {
+		err = commitTransaction(ctx, c, c.proc, nil, stats)
+	}
+	return result, err
+}
+
+// bulkInsertQuery returns the INSERT query of BulkInsert without values.
+// The query is rewritten and checked in the same way as the statements passed to Exec,
+// so the table can be specified by a logical name of a table alias or a name qualified by an attached schema.
+func (c *Conn) bulkInsertQuery(ctx context.Context, table string, columns []string) (parser.InsertQuery, error) {
+	tableName := option.QuoteIdentifier(table)
+	if a, name, ok := c.attachedTable(table); ok {
+		tableName = a.schema + "." + option.QuoteIdentifier(name)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	queryString := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, quoteIdentifiers(columns), placeholders)
+
+	written, err := c.writtenStatements(queryString, true)
+	if err != nil {
+		return parser.InsertQuery{}, err
+	}
+	rewritten, err := c.rewriteQuery(queryString)
+	if err != nil {
+		return parser.InsertQuery{}, err
+	}
+	statements, _, err := parser.Parse(rewritten, "", true, c.proc.Tx.Flags.AnsiQuotes)
+	if err != nil {
+		return parser.InsertQuery{}, query.NewSyntaxError(err.(*parser.SyntaxError))
+	}
+	if err = c.checkStatements(ctx, written, statements); err != nil {
+		return parser.InsertQuery{}, err
+	}
+	insertQuery, ok := statements[0].(parser.InsertQuery)
+	if len(statements) != 1 || !ok {
+		return parser.InsertQuery{}, fmt.Errorf("invalid table %q", table)
+	}
+
+	// Errors of the columns are reported by the names as passed, without the positions in the generated query.
+	fields := make([]parser.QueryExpression, 0, len(columns))
+	for _, col := range columns {
+		fields = append(fields, parser.FieldReference{Column: parser.Identifier{Literal: col}})
+	}
+	insertQuery.Fields = fields
+	return insertQuery, nil
+}
+
+func bulkInsertRowValue(rows RowSource, numColumns int) (parser.QueryExpression, error) {
+	values, err := rows.Values()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != numColumns {
+		return nil, fmt.Errorf("%d values are given for %d columns", len(values), numColumns)
+	}
+
+	list := make([]parser.QueryExpression, 0, len(values))
+	for i, v := range values {
+		converted, err := (ValueConverter{}).ConvertValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("value %d: %w", i+1, err)
+		}
+		list = append(list, converted.(Value).PrimitiveType())
+	}
+	return parser.RowValue{Value: parser.ValueList{Values: list}}, nil
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, option.QuoteIdentifier(name))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// BulkInsert inserts the rows into the table through the connection.
+func BulkInsert(ctx context.Context, conn *sql.Conn, table string, columns []string, rows RowSource, options *BulkInsertOptions) (BulkInsertResult, error) {
+	var result BulkInsertResult
+	err := conn.Raw(func(driverConn interface{}) (err error) {
+		result, err = driverConn.(*Conn).BulkInsert(ctx, table, columns, rows, options)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,177 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+func TestBulkInsert(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests*10)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", TestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	ch := make(chan []interface{})
+	go func() {
+		for i := 4; i <= 8; i++ {
+			ch <- []interface{}{i, fmt.Sprintf("str%d", i)}
+		}
+		ch <- []interface{}{9}
+		ch <- []interface{}{10, struct{}{}}
+		close(ch)
+	}()
+
+	var progress []int64
+	result, err := BulkInsert(ctx, conn, "table_bulk.csv", []string{"col1", "col2"}, RowsFromChannel(ch), &BulkInsertOptions{
+		BatchSize:       2,
+		SkipInvalidRows: true,
+		Progress: func(inserted int64) {
+			progress = append(progress, inserted)
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if result.RowsInserted != 5 {
+		t.Fatalf("rows inserted = %d, want %d", result.RowsInserted, 5)
+	}
+	if !reflect.DeepEqual(progress, []int64{2, 4, 5}) {
+		t.Fatalf("progress = %v, want %v", progress, []int64{2, 4, 5})
+	}
+	if len(result.Errors) != 2 || result.Errors[0].Row != 6 || result.Errors[1].Row != 7 {
+		t.Fatalf("errors = %v, want errors of row 6 and 7", result.Errors)
+	}
+
+	var count int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM `table_bulk.csv`").Scan(&count); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if count != 8 {
+		t.Fatalf("count = %d, want %d", count, 8)
+	}
+}
+
+func TestBulkInsert_Error(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests*10)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", TestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var before int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM `table_bulk.csv`").Scan(&before); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	rows := RowsFromSlice([][]interface{}{
+		{100, "a"},
+		{101, "b"},
+		{102},
+	})
+	_, err = BulkInsert(ctx, conn, "table_bulk.csv", []string{"col1", "col2"}, rows, &BulkInsertOptions{BatchSize: 1})
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) || rowErr.Row != 3 {
+		t.Fatalf("error = %v, want an error of row 3", err)
+	}
+
+	_, err = BulkInsert(ctx, conn, "table_bulk.csv", []string{"notexist"}, RowsFromSlice([][]interface{}{{1}}), nil)
+	if err == nil || err.Error() != "field notexist does not exist" {
+		t.Fatalf("error = %v, want error for a column that does not exist", err)
+	}
+
+	var after int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM `table_bulk.csv`").Scan(&after); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if after != before {
+		t.Fatalf("count = %d, want %d", after, before)
+	}
+}
+
+func TestBulkInsert_Rewrite(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests*10)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TestDir, WithTableAlias("typed", TableAlias{Path: filepath.Join(TableSchemaTestDir, "typed.csv")})))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	rows := RowsFromSlice([][]interface{}{{4, "x"}})
+	_, err = BulkInsert(ctx, conn, "typed", []string{"id", "active"}, rows, nil)
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Column != "active" {
+		t.Fatalf("error = %v, want a schema error of column active", err)
+	}
+
+	result, err := BulkInsert(ctx, conn, "typed", []string{"id", "active"}, RowsFromSlice([][]interface{}{{4, true}}), nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if result.RowsInserted != 1 {
+		t.Fatalf("rows inserted = %d, want %d", result.RowsInserted, 1)
+	}
+	if _, err = conn.ExecContext(ctx, "DELETE FROM typed WHERE id = 4"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+}
+
+func TestBulkInsert_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", TestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	ch := make(chan []interface{})
+	_, err = BulkInsert(ctx, conn, "table_bulk.csv", []string{"col1", "col2"}, RowsFromChannel(ch), nil)
+	if expect := query.ConvertContextError(context.DeadlineExceeded); err == nil || err.Error() != expect.Error() {
+		t.Fatalf("error = %v, want a context error", err)
+	}
+}
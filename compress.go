@@ -0,0 +1,190 @@
+package csvq
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses and decompresses files that have one of the extensions.
+// NewWriter can be nil if the codec does not support compression.
+type Codec struct {
+	Name       string
+	Extensions []string
+	NewReader  func(r io.Reader) (io.ReadCloser, error)
+	NewWriter  func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = []Codec{
+		{
+			Name:       "gzip",
+			Extensions: []string{".gz"},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriter(w), nil
+			},
+		},
+		{
+			Name:       "bzip2",
+			Extensions: []string{".bz2"},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return io.NopCloser(bzip2.NewReader(r)), nil
+			},
+		},
+		{
+			Name:       "zstd",
+			Extensions: []string{".zst", ".zstd"},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				d, err := zstd.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				return d.IOReadCloser(), nil
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return zstd.NewWriter(w)
+			},
+		},
+	}
+)
+
+// RegisterCodec registers a codec for files with the extensions of the codec.
+// If a codec with the same name is already registered, the codec is replaced.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	for i := range codecs {
+		if strings.EqualFold(codecs[i].Name, codec.Name) {
+			codecs[i] = codec
+			return
+		}
+	}
+	codecs = append(codecs, codec)
+}
+
+func codecByName(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	for _, codec := range codecs {
+		if strings.EqualFold(codec.Name, name) {
+			return codec, true
+		}
+	}
+	return Codec{}, false
+}
+
+// codecFor returns the codec for the file name and the extension of the codec in the file name.
+func codecFor(name string) (Codec, string, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	lower := strings.ToLower(name)
+	for _, codec := range codecs {
+		for _, ext := range codec.Extensions {
+			if len(ext) < len(lower) && strings.HasSuffix(lower, strings.ToLower(ext)) {
+				return codec, name[:len(name)-len(ext)], true
+			}
+		}
+	}
+	return Codec{}, name, false
+}
+
+func (codec Codec) newReader(r io.Reader) (io.ReadCloser, error) {
+	if codec.NewReader == nil {
+		return nil, fmt.Errorf("%s decompression is not available: register an implementation with RegisterCodec", codec.Name)
+	}
+	return codec.NewReader(r)
+}
+
+func (codec Codec) checkWriter() error {
+	if codec.NewWriter == nil {
+		return fmt.Errorf("%s compression is not available: register an implementation with RegisterCodec", codec.Name)
+	}
+	return nil
+}
+
+func (codec Codec) newWriter(w io.Writer) (io.WriteCloser, error) {
+	if err := codec.checkWriter(); err != nil {
+		return nil, err
+	}
+	return codec.NewWriter(w)
+}
+
+// compressFile returns a function that writes the file compressed with the codec.
+func compressFile(codec Codec, name string) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		fp, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = fp.Close() }()
+
+		cw, err := codec.newWriter(w)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(cw, fp); err != nil {
+			_ = cw.Close()
+			return err
+		}
+		return cw.Close()
+	}
+}
+
+// writeFileAtomically writes the file to a temporary file in the same directory and renames it to the file,
+// so that the existing file is not corrupted if the writing fails.
+// If check is not nil, it is called just before the renaming, and the file is not replaced if check returns an error.
+func writeFileAtomically(name string, write func(w io.Writer) error, check func() error) error {
+	perm := fs.FileMode(0644)
+	if info, err := os.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	cleanup := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = write(tmp); err != nil {
+		return cleanup(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return cleanup(err)
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return cleanup(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return cleanup(err)
+	}
+	if check != nil {
+		if err = check(); err != nil {
+			_ = os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
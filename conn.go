@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -37,6 +38,17 @@ type Conn struct {
 	retryDelay         time.Duration
 	proc               *query.Processor
 	id                 int
+	options            *connectorOptions
+	fs                 *fsRepository
+	archives           *archiveCache
+	compression        *Codec
+	sandbox            *sandbox
+	limits             Limits
+	stmtCache          *stmtCache
+	placeholder        string
+	profile            *profile
+	tableAliases       map[string]TableAlias
+	attachments        []attachment
 }
 
 type DSN struct {
@@ -44,42 +56,182 @@ type DSN struct {
 	timezone       string
 	datetimeFormat string
 	ansiQuotes     bool
+	compression    string
+	sandbox        bool
+	limits         Limits
+	stmtCacheSize  *int
+	placeholder    string
+	envFile        string
+	attachments    []attachment
+	// timezoneSet and ansiQuotesSet are true if the parameters are specified with values,
+	// so that they override the settings in the environment file even if the values are the defaults.
+	timezoneSet   bool
+	ansiQuotesSet bool
 }
 
 var DSNParseErr = errors.New("incorrect data source name")
 
+type DSNError struct {
+	Key      string
+	Position int
+	Message  string
+}
+
+func NewDSNError(key string, position int, message string) error {
+	return &DSNError{
+		Key:      key,
+		Position: position,
+		Message:  message,
+	}
+}
+
+func (e DSNError) Error() string {
+	return fmt.Sprintf("%s: %s at position %d", DSNParseErr.Error(), e.Message, e.Position)
+}
+
+func (e DSNError) Unwrap() error {
+	return DSNParseErr
+}
+
 func NewConn(ctx context.Context, dsnStr string, defaultWaitTimeout time.Duration, retryDelay time.Duration) (*Conn, error) {
+	return newConn(ctx, dsnStr, defaultWaitTimeout, retryDelay, newConnectorOptions())
+}
+
+func newConn(ctx context.Context, dsnStr string, defaultWaitTimeout time.Duration, retryDelay time.Duration, options *connectorOptions) (conn *Conn, err error) {
+	ctx, span := startSpan(ctx, options, OperationConnect)
+	defer func() {
+		span.End(err)
+	}()
+
 	dsn, err := ParseDSN(dsnStr)
 	if err != nil {
-		return nil, driver.ErrBadConn
+		return nil, err
 	}
 
 	sess := getSession()
 
 	tx, err := query.NewTransaction(ctx, defaultWaitTimeout, retryDelay, sess)
 	if err != nil {
-		return nil, driver.ErrBadConn
+		return nil, err
+	}
+
+	var repository *fsRepository
+	if options.fsys != nil {
+		if repository, err = newFSRepository(options.fsys, dsn.repository, &options.fsMu); err != nil {
+			return nil, err
+		}
+		dsn.repository = repository.dir
+		defer func() {
+			if err != nil {
+				_ = repository.close()
+			}
+		}()
 	}
 
 	if err := tx.Flags.SetRepository(dsn.repository); err != nil {
-		return nil, driver.ErrBadConn
+		return nil, fmt.Errorf("invalid repository %q: %w", dsn.repository, err)
 	}
-	if err := tx.Flags.SetLocation(dsn.timezone); err != nil {
-		return nil, driver.ErrBadConn
+	span.SetAttributes(Attribute{Key: AttributeRepository, Value: tx.Flags.Repository})
+
+	attachments, err := attachRepositories(dsn.attachments, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var box *sandbox
+	if dsn.sandbox || options.sandbox {
+		repositoryDir, err := repositoryPath(tx.Flags)
+		if err != nil {
+			return nil, err
+		}
+		dirs := append(append([]string{repositoryDir}, options.sandboxDirs...), attachmentDirs(attachments)...)
+		if box, err = newSandbox(dirs); err != nil {
+			return nil, err
+		}
+	}
+
+	if 0 < len(dsn.envFile) {
+		env, err := loadEnvironment(dsn.envFile, box)
+		if err != nil {
+			return nil, err
+		}
+		if err = applyEnvironment(tx, env); err != nil {
+			return nil, err
+		}
+		// The settings in the environment file are overridden by the parameters specified with values.
+		if dsn.timezoneSet {
+			if err := tx.Flags.SetLocation(dsn.timezone); err != nil {
+				return nil, fmt.Errorf("invalid timezone %q: %w", dsn.timezone, err)
+			}
+		}
+		if dsn.ansiQuotesSet {
+			tx.Flags.SetAnsiQuotes(dsn.ansiQuotes)
+		}
+	} else {
+		if err := tx.Flags.SetLocation(dsn.timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", dsn.timezone, err)
+		}
+		tx.Flags.SetAnsiQuotes(dsn.ansiQuotes)
 	}
 	tx.Flags.SetDatetimeFormat(dsn.datetimeFormat)
-	tx.Flags.SetAnsiQuotes(dsn.ansiQuotes)
+
+	var compression *Codec
+	if 0 < len(dsn.compression) {
+		codec, ok := codecByName(dsn.compression)
+		if !ok {
+			return nil, fmt.Errorf("invalid compression %q: codec is not registered", dsn.compression)
+		}
+		if len(codec.Extensions) < 1 {
+			return nil, fmt.Errorf("invalid compression %q: codec has no extensions", dsn.compression)
+		}
+		if err := codec.checkWriter(); err != nil {
+			return nil, fmt.Errorf("invalid compression %q: %w", dsn.compression, err)
+		}
+		compression = &codec
+	}
+
+	aliases, err := tableAliases(options)
+	if err != nil {
+		return nil, err
+	}
+
+	stmtCacheSize := options.stmtCacheSize
+	if dsn.stmtCacheSize != nil {
+		stmtCacheSize = *dsn.stmtCacheSize
+	}
 
 	proc := query.NewProcessor(tx)
 	proc.Tx.AutoCommit = true
 
-	return &Conn{
-		dsn:  dsnStr,
-		proc: proc,
-	}, nil
+	if options.metrics != nil {
+		options.metrics.AddOpenConnections(1)
+	}
+
+	c := &Conn{
+		dsn:          dsnStr,
+		proc:         proc,
+		options:      options,
+		fs:           repository,
+		compression:  compression,
+		sandbox:      box,
+		limits:       dsn.limits.merge(options.limits),
+		stmtCache:    newStmtCache(stmtCacheSize),
+		placeholder:  strings.ToLower(dsn.placeholder),
+		tableAliases: aliases,
+		attachments:  attachments,
+	}
+	if err := c.applyProfile(ctx); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
 }
 
 func (c *Conn) Close() error {
+	if c.proc == nil {
+		return nil
+	}
+
 	var errs []error
 
 	if err := c.proc.AutoRollback(); err != nil {
@@ -88,6 +240,19 @@ func (c *Conn) Close() error {
 	if err := c.proc.ReleaseResourcesWithErrors(); err != nil {
 		errs = append(errs, err)
 	}
+	if c.fs != nil {
+		if err := c.fs.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.archives.close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	c.proc = nil
+	if c.options != nil && c.options.metrics != nil {
+		c.options.metrics.AddOpenConnections(-1)
+	}
 
 	var err error
 	switch len(errs) {
@@ -101,12 +266,107 @@ func (c *Conn) Close() error {
 	return err
 }
 
+func (c *Conn) IsValid() bool {
+	return c.proc != nil
+}
+
+// ResetSession is called by database/sql before the connection is reused.
+// The cached prepared statements are removed, and the profile passed by WithProfile is applied again.
+func (c *Conn) ResetSession(ctx context.Context) error {
+	if c.proc == nil {
+		return driver.ErrBadConn
+	}
+	c.stmtCache.clear()
+	return c.resetProfile(ctx)
+}
+
+// CheckNamedValue accepts the arguments passed as sql.Out that are bound to user variables.
+// Other arguments are converted by database/sql.
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ok, err := checkOutArgument(nv); ok {
+		return err
+	}
+	return driver.ErrSkip
+}
+
 func (c *Conn) Prepare(queryString string) (driver.Stmt, error) {
 	return c.PrepareContext(context.Background(), queryString)
 }
 
 func (c *Conn) PrepareContext(ctx context.Context, queryString string) (driver.Stmt, error) {
-	return NewStmt(ctx, c.proc, queryString)
+	if c.proc == nil {
+		return nil, driver.ErrBadConn
+	}
+	return c.prepare(ctx, queryString)
+}
+
+func (c *Conn) prepare(ctx context.Context, queryString string) (s *Stmt, err error) {
+	ctx, span := startSpan(ctx, c.options, OperationPrepare, c.statementAttributes(queryString)...)
+	defer func() {
+		span.End(err)
+	}()
+
+	key := stmtCacheKey{
+		queryString: queryString,
+		repository:  c.proc.Tx.Flags.Repository,
+		ansiQuotes:  c.proc.Tx.Flags.AnsiQuotes,
+	}
+	if c.placeholder == PlaceholderAt {
+		// Variables declared in the connection are not placeholders, so statements are cached for the variables.
+		key.variables = c.variableNames()
+	}
+	s, ok := c.stmtCache.get(key)
+	if !ok {
+		// Placeholders are rewritten first so that the query string can be parsed to find the tables.
+		rewritten, ordinals, err := c.rewritePlaceholders(queryString)
+		if err != nil {
+			return nil, err
+		}
+		written, err := c.writtenStatements(rewritten, true)
+		if err != nil {
+			return nil, err
+		}
+		rewritten, err = c.rewriteQuery(rewritten)
+		if err != nil {
+			return nil, err
+		}
+		stmt, err := NewStmt(ctx, c.proc, rewritten)
+		if err != nil {
+			return nil, err
+		}
+		s = stmt.(*Stmt)
+		s.queryString = queryString
+		s.written = written
+		s.conn = c
+		s.setOrdinals(ordinals)
+		s = c.stmtCache.put(key, s)
+	}
+	span.SetAttributes(Attribute{Key: AttributeCached, Value: ok})
+
+	// Statements from the cache are also checked because the results can change, such as by symbolic links.
+	if err = c.checkStatements(ctx, s.written, s.statements); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	span.SetAttributes(Attribute{Key: AttributeFiles, Value: referencedTables(s.statements)})
+	return s, nil
+}
+
+// rewriteQuery rewrites the syntax that the driver supports in addition to csvq into the syntax of csvq.
+func (c *Conn) rewriteQuery(queryString string) (string, error) {
+	queryString = quoteQualifiedNames(queryString, c.proc.Tx.Flags.AnsiQuotes, isInformationSchema)
+	queryString, err := c.rewriteArchivePaths(queryString)
+	if err != nil {
+		return queryString, err
+	}
+	return c.rewriteTableAliases(c.rewriteAttachedTables(queryString)), nil
+}
+
+func (c *Conn) statementAttributes(queryString string) []Attribute {
+	return []Attribute{
+		{Key: AttributeStatement, Value: queryString},
+		{Key: AttributeRepository, Value: c.proc.Tx.Flags.Repository},
+	}
 }
 
 func (c *Conn) Begin() (driver.Tx, error) {
@@ -120,66 +380,126 @@ func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 	if opts.ReadOnly {
 		return nil, errors.New("csvq does not support read-only transactions")
 	}
+	if c.proc == nil {
+		return nil, driver.ErrBadConn
+	}
 
-	return NewTx(c.proc)
+	tx, err := NewTx(c.proc)
+	if err != nil {
+		return nil, err
+	}
+	tx.(*Tx).conn = c
+	tx.(*Tx).ctx = ctx
+	return tx, nil
 }
 
 func (c *Conn) QueryContext(ctx context.Context, queryString string, args []driver.NamedValue) (driver.Rows, error) {
-	if err := c.exec(ctx, queryString, args); err != nil {
+	statements, err := c.exec(contextForShowResults(ctx), OperationQuery, queryString, args)
+	if err != nil {
 		return nil, err
 	}
-	return NewRows(c.proc.Tx.SelectedViews), nil
+
+	rows := newTracedRows(ctx, c.options, c.proc.Tx.SelectedViews)
+	if err := c.applyTableSchemas(rows, statements); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	return rows, nil
 }
 
 func (c *Conn) ExecContext(ctx context.Context, queryString string, args []driver.NamedValue) (driver.Result, error) {
-	if err := c.exec(ctx, queryString, args); err != nil {
+	if _, err := c.exec(ctx, OperationExec, queryString, args); err != nil {
 		return nil, err
 	}
 	return NewResult(int64(c.proc.Tx.AffectedRows)), nil
 }
 
-func (c *Conn) exec(ctx context.Context, queryString string, args []driver.NamedValue) error {
+func (c *Conn) exec(ctx context.Context, operation string, queryString string, args []driver.NamedValue) (statements []parser.Statement, err error) {
+	if c.proc == nil {
+		return nil, driver.ErrBadConn
+	}
+
+	var stats *executionStats
+	ctx, obs := startObservation(ctx, c.options, operation, queryString, c.proc.Tx.Flags.Repository, args)
+	defer func() {
+		obs.finish(ctx, c.proc.Tx, stats, err)
+	}()
+
+	outs, args := splitOutArguments(args)
+	if err = bindOutArguments(c.proc, outs); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err == nil {
+			err = readOutArguments(c.proc, outs)
+		}
+	}()
+
 	if 0 < len(args) {
 		var selectedViews []*query.View
 		var affectedRows int
 
-		stmt, err := c.PrepareContext(ctx, queryString)
+		stmt, err := c.prepare(ctx, queryString)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer func() {
 			_ = stmt.Close()
 			c.proc.Tx.SelectedViews = selectedViews
 			c.proc.Tx.AffectedRows = affectedRows
 		}()
+		obs.setStatements(stmt.statements)
 
-		err = stmt.(*Stmt).exec(ctx, args)
+		stats, err = stmt.execute(ctx, args)
 		if err == nil {
-			selectedViews = stmt.(*Stmt).proc.Tx.SelectedViews
-			affectedRows = stmt.(*Stmt).proc.Tx.AffectedRows
+			selectedViews = stmt.proc.Tx.SelectedViews
+			affectedRows = stmt.proc.Tx.AffectedRows
 		}
-		return err
+		return stmt.statements, err
+	}
+
+	written, err := c.writtenStatements(queryString, false)
+	if err != nil {
+		return nil, err
+	}
+	rewritten, err := c.rewriteQuery(queryString)
+	if err != nil {
+		return nil, err
+	}
+	statements, _, err = parser.Parse(rewritten, "", false, c.proc.Tx.Flags.AnsiQuotes)
+	if err != nil {
+		return nil, query.NewSyntaxError(err.(*parser.SyntaxError))
+	}
+	obs.setStatements(statements)
+
+	if err = c.checkStatements(ctx, written, statements); err != nil {
+		return nil, err
 	}
 
-	statements, _, err := parser.Parse(queryString, "", false, c.proc.Tx.Flags.AnsiQuotes)
+	dispose, err := c.declareVirtualTables(ctx, statements)
 	if err != nil {
-		return query.NewSyntaxError(err.(*parser.SyntaxError))
+		return nil, err
 	}
+	defer dispose()
 
-	_, err = c.proc.Execute(query.ContextForStoringResults(ctx), statements)
-	return err
+	stats, err = executeStatements(query.ContextForStoringResults(ctx), c, c.proc, statements)
+	return statements, err
 }
 
 func ParseDSN(dsnStr string) (DSN, error) {
 	type parameter struct {
-		key   []rune
-		value []rune
+		key      []rune
+		value    []rune
+		keyPos   int
+		valuePos int
 	}
 
-	readParam := func(r []rune) (parameter, []rune) {
+	readParam := func(r []rune, pos int) (parameter, []rune, int) {
 		p := parameter{
-			key:   []rune{},
-			value: []rune{},
+			key:      []rune{},
+			value:    []rune{},
+			keyPos:   pos,
+			valuePos: pos,
 		}
 
 		inKeyStr := true
@@ -221,6 +541,9 @@ func ParseDSN(dsnStr string) (DSN, error) {
 			}
 
 			if c == '=' {
+				if inKeyStr {
+					p.valuePos = pos + i + 1
+				}
 				inKeyStr = false
 				continue
 			}
@@ -233,10 +556,10 @@ func ParseDSN(dsnStr string) (DSN, error) {
 		}
 
 		if spIdx < 1 || len(r) <= spIdx+1 {
-			return p, nil
+			return p, nil, 0
 		}
 
-		return p, r[spIdx+1:]
+		return p, r[spIdx+1:], pos + spIdx + 1
 	}
 
 	dsn := DSN{
@@ -244,25 +567,29 @@ func ParseDSN(dsnStr string) (DSN, error) {
 		timezone:       "Local",
 		datetimeFormat: "",
 		ansiQuotes:     false,
+		compression:    "",
+		sandbox:        false,
 	}
 
-	spIdx := strings.Index(dsnStr, "?")
+	dsnRunes := []rune(dsnStr)
+
+	spIdx := indexRune(dsnRunes, '?')
 	if spIdx < 0 {
 		dsn.repository = dsnStr
 		return dsn, nil
 	}
 
-	dsnRunes := []rune(dsnStr)
-
 	dsn.repository = string(dsnRunes[0:spIdx])
 
 	var params []parameter
 	if spIdx+1 < len(dsnRunes) {
 		r := dsnRunes[spIdx+1:]
+		pos := spIdx + 1
 		for r != nil {
-			p, rest := readParam(r)
+			p, rest, next := readParam(r, pos)
 			params = append(params, p)
 			r = rest
+			pos = next
 		}
 	}
 
@@ -274,6 +601,7 @@ func ParseDSN(dsnStr string) (DSN, error) {
 		case "TIMEZONE":
 			if 0 < len(v) {
 				dsn.timezone = v
+				dsn.timezoneSet = true
 			}
 		case "DATETIMEFORMAT":
 			if 0 < len(v) {
@@ -283,14 +611,80 @@ func ParseDSN(dsnStr string) (DSN, error) {
 			if 0 < len(v) {
 				b, err := strconv.ParseBool(v)
 				if err != nil {
-					return dsn, DSNParseErr
+					return dsn, NewDSNError(k, p.valuePos, fmt.Sprintf("invalid boolean value %q for parameter %q", v, k))
 				}
 				dsn.ansiQuotes = b
+				dsn.ansiQuotesSet = true
+			}
+		case "COMPRESSION":
+			dsn.compression = v
+		case "SANDBOX":
+			if 0 < len(v) {
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					return dsn, NewDSNError(k, p.valuePos, fmt.Sprintf("invalid boolean value %q for parameter %q", v, k))
+				}
+				dsn.sandbox = b
+			}
+		case "MAXROWSSCANNED", "MAXROWSRETURNED", "MAXBYTESLOADED":
+			if 0 < len(v) {
+				i, err := strconv.ParseInt(v, 10, 64)
+				if err != nil || i < 0 {
+					return dsn, NewDSNError(k, p.valuePos, fmt.Sprintf("invalid integer value %q for parameter %q", v, k))
+				}
+				switch strings.ToUpper(k) {
+				case "MAXROWSSCANNED":
+					dsn.limits.MaxRowsScanned = int(i)
+				case "MAXROWSRETURNED":
+					dsn.limits.MaxRowsReturned = int(i)
+				default:
+					dsn.limits.MaxBytesLoaded = i
+				}
+			}
+		case "ATTACH", "ATTACHREADONLY":
+			a, err := parseAttachment(v, strings.EqualFold(k, "ATTACHREADONLY"))
+			if err != nil {
+				return dsn, NewDSNError(k, p.valuePos, fmt.Sprintf("invalid value %q for parameter %q: %s", v, k, err.Error()))
+			}
+			dsn.attachments = append(dsn.attachments, a)
+		case "ENVFILE":
+			dsn.envFile = v
+		case "PLACEHOLDER":
+			if 0 < len(v) {
+				if !isPlaceholderDialect(v) {
+					return dsn, NewDSNError(k, p.valuePos, fmt.Sprintf("invalid placeholder dialect %q for parameter %q", v, k))
+				}
+				dsn.placeholder = v
+			}
+		case "STMTCACHESIZE":
+			if 0 < len(v) {
+				i, err := strconv.Atoi(v)
+				if err != nil || i < 0 {
+					return dsn, NewDSNError(k, p.valuePos, fmt.Sprintf("invalid integer value %q for parameter %q", v, k))
+				}
+				dsn.stmtCacheSize = &i
+			}
+		case "MAXEXECUTIONTIME":
+			if 0 < len(v) {
+				d, err := time.ParseDuration(v)
+				if err != nil || d < 0 {
+					return dsn, NewDSNError(k, p.valuePos, fmt.Sprintf("invalid duration value %q for parameter %q", v, k))
+				}
+				dsn.limits.MaxExecutionTime = d
 			}
 		default:
-			return dsn, DSNParseErr
+			return dsn, NewDSNError(k, p.keyPos, fmt.Sprintf("unknown parameter %q", k))
 		}
 	}
 
 	return dsn, nil
 }
+
+func indexRune(r []rune, c rune) int {
+	for i := range r {
+		if r[i] == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -3,8 +3,11 @@ package csvq
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mithrandie/csvq/lib/query"
 )
@@ -61,6 +64,31 @@ func TestConn_BeginTx(t *testing.T) {
 	}
 }
 
+func TestConn_Close(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	c, err := NewConn(ctx, TestDir, waitTimeoutForTests, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if !c.IsValid() {
+		t.Fatal("connection is not valid, want valid")
+	}
+
+	if err = c.Close(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if c.IsValid() {
+		t.Fatal("connection is valid, want invalid")
+	}
+
+	_, err = c.ExecContext(ctx, "SELECT 1", nil)
+	if err != driver.ErrBadConn {
+		t.Fatalf("error = %v, want error %q", err, driver.ErrBadConn)
+	}
+}
+
 func TestConn_QueryContext(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
 	defer cancel()
@@ -222,6 +250,7 @@ var parseDSNTests = []struct {
 	DSN      string
 	Result   DSN
 	HasError bool
+	Error    string
 }{
 	{
 		DSN: "/path/to/data/directory",
@@ -250,6 +279,8 @@ var parseDSNTests = []struct {
 			timezone:       "UTC",
 			datetimeFormat: "[\"%d%m%Y\"]",
 			ansiQuotes:     true,
+			timezoneSet:    true,
+			ansiQuotesSet:  true,
 		},
 		HasError: false,
 	},
@@ -260,6 +291,8 @@ var parseDSNTests = []struct {
 			timezone:       "UTC",
 			datetimeFormat: "[\"%d%m%Y\"]",
 			ansiQuotes:     true,
+			timezoneSet:    true,
+			ansiQuotesSet:  true,
 		},
 		HasError: false,
 	},
@@ -290,16 +323,119 @@ var parseDSNTests = []struct {
 			timezone:       "Local",
 			datetimeFormat: "",
 			ansiQuotes:     true,
+			ansiQuotesSet:  true,
 		},
 		HasError: false,
 	},
+	{
+		DSN: "/path/to/data/directory?Compression=gzip",
+		Result: DSN{
+			repository:     "/path/to/data/directory",
+			timezone:       "Local",
+			datetimeFormat: "",
+			ansiQuotes:     false,
+			compression:    "gzip",
+		},
+		HasError: false,
+	},
+	{
+		DSN: "/path/to/data/directory?Sandbox=true",
+		Result: DSN{
+			repository:     "/path/to/data/directory",
+			timezone:       "Local",
+			datetimeFormat: "",
+			ansiQuotes:     false,
+			sandbox:        true,
+		},
+		HasError: false,
+	},
+	{
+		DSN: "/path/to/data/directory?MaxRowsScanned=1000&MaxRowsReturned=100&MaxBytesLoaded=1048576&MaxExecutionTime=30s",
+		Result: DSN{
+			repository:     "/path/to/data/directory",
+			timezone:       "Local",
+			datetimeFormat: "",
+			ansiQuotes:     false,
+			limits: Limits{
+				MaxRowsScanned:   1000,
+				MaxRowsReturned:  100,
+				MaxBytesLoaded:   1048576,
+				MaxExecutionTime: 30 * time.Second,
+			},
+		},
+		HasError: false,
+	},
+	{
+		DSN: "/path/to/data/directory?StmtCacheSize=0",
+		Result: DSN{
+			repository:     "/path/to/data/directory",
+			timezone:       "Local",
+			datetimeFormat: "",
+			ansiQuotes:     false,
+			stmtCacheSize:  new(int),
+		},
+		HasError: false,
+	},
+	{
+		DSN: "/path/to/data/directory?Placeholder=Dollar",
+		Result: DSN{
+			repository:     "/path/to/data/directory",
+			timezone:       "Local",
+			datetimeFormat: "",
+			ansiQuotes:     false,
+			placeholder:    "Dollar",
+		},
+		HasError: false,
+	},
+	{
+		DSN: "/path/to/data/directory?EnvFile=none",
+		Result: DSN{
+			repository:     "/path/to/data/directory",
+			timezone:       "Local",
+			datetimeFormat: "",
+			ansiQuotes:     false,
+			envFile:        "none",
+		},
+		HasError: false,
+	},
+	{
+		DSN: "/path/to/data/directory?Attach=work:/path/to/work&AttachReadOnly=ref:/path/to/ref",
+		Result: DSN{
+			repository:     "/path/to/data/directory",
+			timezone:       "Local",
+			datetimeFormat: "",
+			ansiQuotes:     false,
+			attachments: []attachment{
+				{schema: "work", dir: "/path/to/work", readOnly: false},
+				{schema: "ref", dir: "/path/to/ref", readOnly: true},
+			},
+		},
+		HasError: false,
+	},
+	{
+		DSN:      "/path/to/data/directory?Attach=/path/to/ref",
+		HasError: true,
+		Error:    "incorrect data source name: invalid value \"/path/to/ref\" for parameter \"Attach\": repository must be specified as \"schema:path\" at position 31",
+	},
+	{
+		DSN:      "/path/to/data/directory?Placeholder=colon",
+		HasError: true,
+		Error:    "incorrect data source name: invalid placeholder dialect \"colon\" for parameter \"Placeholder\" at position 36",
+	},
+	{
+		DSN:      "/path/to/data/directory?MaxExecutionTime=30",
+		HasError: true,
+		Error:    "incorrect data source name: invalid duration value \"30\" for parameter \"MaxExecutionTime\" at position 41",
+	},
 	{
 		DSN:      "/path/to/data/directory?timezone&datetimeformat&ansiquotes=err&",
 		HasError: true,
+		Error:    "incorrect data source name: invalid boolean value \"err\" for parameter \"ansiquotes\" at position 59",
 	},
 	{
 		DSN:      "/path/to/data/directory?Timezone=UTC&IncorrectParam=true",
 		HasError: true,
+		Error:    "incorrect data source name: unknown parameter \"IncorrectParam\" at position 37",
 	},
 }
 
@@ -309,6 +445,13 @@ func TestParseDSN(t *testing.T) {
 		if v.HasError {
 			if err == nil {
 				t.Errorf("%s: no error has returned", v.DSN)
+				continue
+			}
+			if !errors.Is(err, DSNParseErr) {
+				t.Errorf("%s: error %q is not a DSNParseErr", v.DSN, err.Error())
+			}
+			if err.Error() != v.Error {
+				t.Errorf("%s: error = %q, want error %q", v.DSN, err.Error(), v.Error)
 			}
 			continue
 		}
@@ -3,6 +3,9 @@ package csvq
 import (
 	"context"
 	"database/sql/driver"
+	"fmt"
+	"io/fs"
+	"sync"
 
 	"github.com/mithrandie/csvq/lib/file"
 )
@@ -19,19 +22,192 @@ func (d Driver) OpenContext(ctx context.Context, dsn string) (driver.Conn, error
 }
 
 func (d Driver) OpenConnector(dsn string) (driver.Connector, error) {
-	return Connector{
-		dsn:    dsn,
-		driver: d,
-	}, nil
+	return NewConnector(dsn), nil
+}
+
+type ConnectorOption func(*connectorOptions)
+
+type connectorOptions struct {
+	logger   Logger
+	redactor Redactor
+	tracer   Tracer
+	metrics  Metrics
+
+	tableSchemas    map[string]TableSchema
+	tableAliases    map[string]TableAlias
+	tableAliasFiles []string
+	attachments     []attachment
+	fsys            fs.FS
+	fsMu            sync.Mutex
+	sandbox         bool
+	sandboxDirs     []string
+	policy          Policy
+	limits          Limits
+
+	stmtCacheSize int
+	profile       string
+
+	// err is the first error of the options, which is returned when a connection is opened.
+	err error
+}
+
+func newConnectorOptions() *connectorOptions {
+	return &connectorOptions{
+		logger:   nil,
+		redactor: RedactAll,
+		tracer:   noopTracer{},
+
+		stmtCacheSize: DefaultStmtCacheSize,
+	}
+}
+
+// WithLogger sets a logger that records every statement executed through the connections.
+func WithLogger(logger Logger) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.logger = logger
+	}
+}
+
+// WithRedactor replaces the function that masks bound arguments before they are logged.
+// By default, all argument values are replaced with RedactedValue.
+func WithRedactor(redactor Redactor) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.redactor = redactor
+	}
+}
+
+// WithTracer sets a tracer that receives spans for connections, statements, row iterations and transactions.
+func WithTracer(tracer Tracer) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.tracer = tracer
+	}
+}
+
+// WithMetrics sets a Metrics that receives measurements of executions, rows, file I/O and connections.
+func WithMetrics(metrics Metrics) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.metrics = metrics
+	}
+}
+
+// WithTableSchema declares the schema of a table. The table is specified in the same way as in queries.
+// Schemas declared by this option take precedence over schema files.
+// The schema is validated when the connector is created, and connections of the connector fail to open if it is invalid.
+func WithTableSchema(table string, schema TableSchema) ConnectorOption {
+	return func(o *connectorOptions) {
+		if err := schema.validate(); err != nil && o.err == nil {
+			o.err = fmt.Errorf("invalid table schema %s: %w", table, err)
+		}
+		if o.tableSchemas == nil {
+			o.tableSchemas = make(map[string]TableSchema)
+		}
+		o.tableSchemas[table] = schema
+	}
+}
+
+// WithTableAlias maps a logical table name to a file, so that queries refer to the file by the name.
+// Aliases declared by this option take precedence over the aliases in the files passed by WithTableAliasFile.
+func WithTableAlias(name string, alias TableAlias) ConnectorOption {
+	return func(o *connectorOptions) {
+		if o.tableAliases == nil {
+			o.tableAliases = make(map[string]TableAlias)
+		}
+		o.tableAliases[name] = alias
+	}
+}
+
+// WithTableAliasFile reads table aliases from a JSON file that maps logical table names to TableAlias objects.
+// The file is read when a connection is opened. If WithFS is passed, a relative path is read from the file system.
+func WithTableAliasFile(path string) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.tableAliasFiles = append(o.tableAliasFiles, path)
+	}
+}
+
+// WithAttachedRepository attaches the directory to the connections under the schema name, so that the tables in it
+// are referred to by the names qualified by the schema name, such as "ref.countries".
+// If readOnly is true, statements that write to the tables in the directory return a ReadOnlyRepositoryError.
+func WithAttachedRepository(schema string, dir string, readOnly bool) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.attachments = append(o.attachments, attachment{schema: schema, dir: dir, readOnly: readOnly})
+	}
+}
+
+// WithFS sets a file system that the tables are read from instead of the os file system.
+// The repository in the data source name is a directory in the file system, and the root directory by default.
+// If the file system implements WritableFS, created and updated tables are written to it when they are committed.
+func WithFS(fsys fs.FS) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.fsys = fsys
+	}
+}
+
+// WithSandbox confines the file access of the connections to the repository and the directories.
+// Statements that access files outside the directories return a PermissionError.
+func WithSandbox(dirs ...string) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.sandbox = true
+		o.sandboxDirs = append(o.sandboxDirs, dirs...)
+	}
+}
+
+// WithPolicy sets a policy that inspects the statements before they are executed.
+// Statements rejected by the policy are not executed.
+func WithPolicy(policy Policy) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.policy = policy
+	}
+}
+
+// WithLimits sets the limits of the resources that an execution of statements can use.
+// Limits specified in the data source name take precedence.
+func WithLimits(limits Limits) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.limits = limits
+	}
+}
+
+// WithStmtCacheSize sets the number of prepared statements cached by each connection.
+// If size is 0, statements are not cached. The size specified in the data source name takes precedence.
+func WithStmtCacheSize(size int) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.stmtCacheSize = size
+	}
+}
+
+// WithProfile sets the statements executed on every new connection, such as declarations of variables, functions and
+// views, and settings of flags. Every time database/sql resets the session of a connection before reusing it,
+// the session is discarded and the statements are executed again, so that all connections share the same environment.
+func WithProfile(script string) ConnectorOption {
+	return func(o *connectorOptions) {
+		o.profile = script
+	}
 }
 
 type Connector struct {
-	dsn    string
-	driver Driver
+	dsn     string
+	driver  Driver
+	options *connectorOptions
+}
+
+func NewConnector(dsn string, options ...ConnectorOption) Connector {
+	opts := newConnectorOptions()
+	for _, apply := range options {
+		apply(opts)
+	}
+
+	return Connector{
+		dsn:     dsn,
+		driver:  Driver{},
+		options: opts,
+	}
 }
 
 func (t Connector) Connect(ctx context.Context) (driver.Conn, error) {
-	return t.driver.OpenContext(ctx, t.dsn)
+	if t.options.err != nil {
+		return nil, t.options.err
+	}
+	return newConn(ctx, t.dsn, file.DefaultWaitTimeout, file.DefaultRetryDelay, t.options)
 }
 
 func (t Connector) Driver() driver.Driver {
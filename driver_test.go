@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -17,14 +18,31 @@ func TestDriver_Open(t *testing.T) {
 		_ = db.Close()
 	}()
 
-	expectErr := driver.ErrBadConn
+	expectErr := "invalid repository \"" + filepath.Join(TestDir, "notexistdir") + "\": repository does not exist"
 	err := db.PingContext(ctx)
 	if err == nil {
 		t.Fatalf("no error, want error %q", expectErr)
 	}
-	if err != expectErr {
+	if err == driver.ErrBadConn {
 		t.Fatalf("error = %q, want error %q", err.Error(), expectErr)
 	}
+	if err.Error() != expectErr {
+		t.Fatalf("error = %q, want error %q", err.Error(), expectErr)
+	}
+
+	db1, _ := sql.Open("csvq", TestDir+"?Timezone=Notexist/Zone")
+	defer func() {
+		_ = db1.Close()
+	}()
+
+	expectErr = "invalid timezone \"Notexist/Zone\""
+	err = db1.PingContext(ctx)
+	if err == nil {
+		t.Fatalf("no error, want error %q", expectErr)
+	}
+	if !strings.HasPrefix(err.Error(), expectErr) {
+		t.Fatalf("error = %q, want error that has prefix %q", err.Error(), expectErr)
+	}
 
 	db2, _ := sql.Open("csvq", TestDir)
 	defer func() {
@@ -0,0 +1,84 @@
+package csvq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// EnvFileNone is the value of the DSN parameter "EnvFile" that makes connections use the default environment
+// without reading any environment configuration files.
+const EnvFileNone = "none"
+
+// loadEnvironment returns the default environment of csvq merged with the environment configuration file.
+// If name is EnvFileNone, the default environment is returned.
+// Unknown keys in the file are reported as errors to find typos.
+// Environment variables cannot be set by the file, because they would be shared by all the connections in the process.
+func loadEnvironment(name string, box *sandbox) (*option.Environment, error) {
+	env := &option.Environment{}
+	if err := json.Unmarshal([]byte(option.DefaultEnvJson), env); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(name, EnvFileNone) {
+		return env, nil
+	}
+
+	p, err := filepath.Abs(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid environment file %q: %w", name, err)
+	}
+	if box != nil {
+		evaluated, err := evalPath(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid environment file %q: %w", name, err)
+		}
+		if !box.allows(evaluated) {
+			return nil, NewPermissionError(nil, name, fmt.Sprintf("access to %q is not allowed", name))
+		}
+	}
+
+	buf, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid environment file %q: %w", name, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(bytes.TrimSuffix(buf, []byte{0x00})))
+	decoder.DisallowUnknownFields()
+	userDefinedEnv := &option.Environment{}
+	if err = decoder.Decode(userDefinedEnv); err != nil {
+		return nil, fmt.Errorf("invalid environment file %q: %w", name, err)
+	}
+	if 0 < len(userDefinedEnv.EnvironmentVariables) {
+		return nil, fmt.Errorf("invalid environment file %q: environment_variables is not supported", name)
+	}
+	if userDefinedEnv.Timezone != nil {
+		if _, err = option.GetLocation(*userDefinedEnv.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid environment file %q: %w", name, err)
+		}
+	}
+
+	env.Merge(userDefinedEnv)
+	return env, nil
+}
+
+// applyEnvironment replaces the environment of the transaction, and applies the settings of the environment
+// to the flags as csvq does.
+// Interactive shell and palette settings are not used by the driver.
+func applyEnvironment(tx *query.Transaction, env *option.Environment) error {
+	tx.Environment = env
+	tx.Flags.DatetimeFormat = append([]string(nil), env.DatetimeFormat...)
+	if env.Timezone != nil {
+		if err := tx.Flags.SetLocation(*env.Timezone); err != nil {
+			return err
+		}
+	}
+	if env.AnsiQuotes != nil {
+		tx.Flags.SetAnsiQuotes(*env.AnsiQuotes)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvFile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "csvq_env.json")
+	env := `{
+  "datetime_format": ["%d/%m/%Y"],
+  "timezone": "UTC",
+  "ansi_quotes": true
+}`
+	if err := os.WriteFile(envFile, []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidFile := filepath.Join(dir, "invalid_env.json")
+	if err := os.WriteFile(invalidFile, []byte(`{"timezone": "UTC", "ansi_quote": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidTimezoneFile := filepath.Join(dir, "invalid_timezone_env.json")
+	if err := os.WriteFile(invalidTimezoneFile, []byte(`{"timezone": "Invalid/Zone"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	envVarsFile := filepath.Join(dir, "env_vars_env.json")
+	if err := os.WriteFile(envVarsFile, []byte(`{"environment_variables": {"CSVQ_DRIVER_TEST_ENV": "loaded"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(dsn string) *sql.DB {
+		db, err := sql.Open("csvq", dsn)
+		if err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		t.Cleanup(func() {
+			_ = db.Close()
+		})
+		return db
+	}
+
+	t.Run("EnvFile", func(t *testing.T) {
+		db := open(TestDir + "?EnvFile=" + envFile + "&DatetimeFormat=%Y%m%d")
+
+		var formats, timezone string
+		var ansiQuotes bool
+		row := db.QueryRowContext(ctx, `SELECT @@DATETIME_FORMAT, @@TIMEZONE, @@ANSI_QUOTES`)
+		if err := row.Scan(&formats, &timezone, &ansiQuotes); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		if formats != `["%d/%m/%Y", "%Y%m%d"]` || timezone != "UTC" || !ansiQuotes {
+			t.Errorf("result = (%s, %s, %t), want (%s, %s, %t)", formats, timezone, ansiQuotes, `["%d/%m/%Y", "%Y%m%d"]`, "UTC", true)
+		}
+	})
+
+	t.Run("Overridden by DSN", func(t *testing.T) {
+		db := open(TestDir + "?EnvFile=" + envFile + "&Timezone=Asia/Tokyo")
+
+		var timezone string
+		if err := db.QueryRowContext(ctx, `SELECT @@TIMEZONE`).Scan(&timezone); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		if timezone != "Asia/Tokyo" {
+			t.Errorf("timezone = %s, want %s", timezone, "Asia/Tokyo")
+		}
+	})
+
+	t.Run("Defaults Specified in DSN", func(t *testing.T) {
+		db := open(TestDir + "?EnvFile=" + envFile + "&Timezone=Local&AnsiQuotes=false")
+
+		var timezone string
+		var ansiQuotes bool
+		if err := db.QueryRowContext(ctx, `SELECT @@TIMEZONE, @@ANSI_QUOTES`).Scan(&timezone, &ansiQuotes); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		if timezone != "Local" || ansiQuotes {
+			t.Errorf("result = (%s, %t), want (%s, %t)", timezone, ansiQuotes, "Local", false)
+		}
+	})
+
+	t.Run("None", func(t *testing.T) {
+		db := open(TestDir + "?EnvFile=none")
+
+		var formats, timezone string
+		var ansiQuotes bool
+		if err := db.QueryRowContext(ctx, `SELECT @@DATETIME_FORMAT, @@TIMEZONE, @@ANSI_QUOTES`).Scan(&formats, &timezone, &ansiQuotes); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		if formats != "" || timezone != "Local" || ansiQuotes {
+			t.Errorf("result = (%q, %s, %t), want (%q, %s, %t)", formats, timezone, ansiQuotes, "", "Local", false)
+		}
+	})
+
+	errorTests := []struct {
+		Name  string
+		DSN   string
+		Error string
+	}{
+		{
+			Name:  "Not Exist",
+			DSN:   TestDir + "?EnvFile=" + filepath.Join(dir, "notexist.json"),
+			Error: "invalid environment file \"" + filepath.Join(dir, "notexist.json") + "\": open " + filepath.Join(dir, "notexist.json") + ": no such file or directory",
+		},
+		{
+			Name:  "Unknown Field",
+			DSN:   TestDir + "?EnvFile=" + invalidFile,
+			Error: "invalid environment file \"" + invalidFile + "\": json: unknown field \"ansi_quote\"",
+		},
+		{
+			Name:  "Invalid Timezone",
+			DSN:   TestDir + "?EnvFile=" + invalidTimezoneFile,
+			Error: "invalid environment file \"" + invalidTimezoneFile + "\": timezone \"Invalid/Zone\" does not exist",
+		},
+		{
+			Name:  "Environment Variables",
+			DSN:   TestDir + "?EnvFile=" + envVarsFile,
+			Error: "invalid environment file \"" + envVarsFile + "\": environment_variables is not supported",
+		},
+	}
+	for _, v := range errorTests {
+		t.Run(v.Name, func(t *testing.T) {
+			err := open(v.DSN).PingContext(ctx)
+			if err == nil {
+				t.Fatal("no error, want error")
+			}
+			if err.Error() != v.Error {
+				t.Errorf("error = %q, want error %q", err.Error(), v.Error)
+			}
+		})
+	}
+
+	t.Run("Sandbox", func(t *testing.T) {
+		repository, _ := setupSandboxDirs(t)
+		err := open(repository + "?Sandbox=true&EnvFile=" + envFile).PingContext(ctx)
+		if !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("error = %v, want %v", err, ErrPermissionDenied)
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// ExportOptions overrides the export options of the connection, which are set by flags such as @@DELIMITER.
+// Fields with zero values are not overridden.
+type ExportOptions struct {
+	Delimiter            string
+	DelimiterPositions   string
+	Encoding             string
+	LineBreak            string
+	JsonEscape           string
+	WithoutHeader        bool
+	EncloseAll           bool
+	PrettyPrint          bool
+	StripEndingLineBreak bool
+}
+
+func (o *ExportOptions) apply(ops *option.ExportOptions) error {
+	if o == nil {
+		return nil
+	}
+
+	var err error
+	if 0 < len(o.Delimiter) {
+		if ops.Delimiter, err = option.ParseDelimiter(o.Delimiter); err != nil {
+			return err
+		}
+	}
+	if 0 < len(o.DelimiterPositions) {
+		if ops.DelimiterPositions, ops.SingleLine, err = option.ParseDelimiterPositions(o.DelimiterPositions); err != nil {
+			return err
+		}
+	}
+	if 0 < len(o.Encoding) {
+		if ops.Encoding, err = option.ParseEncoding(o.Encoding); err != nil {
+			return err
+		}
+	}
+	if 0 < len(o.LineBreak) {
+		if ops.LineBreak, err = option.ParseLineBreak(o.LineBreak); err != nil {
+			return err
+		}
+	}
+	if 0 < len(o.JsonEscape) {
+		if ops.JsonEscape, err = option.ParseJsonEscapeType(o.JsonEscape); err != nil {
+			return err
+		}
+	}
+	if o.WithoutHeader {
+		ops.WithoutHeader = true
+	}
+	if o.EncloseAll {
+		ops.EncloseAll = true
+	}
+	if o.PrettyPrint {
+		ops.PrettyPrint = true
+	}
+	if o.StripEndingLineBreak {
+		ops.StripEndingLineBreak = true
+	}
+	return nil
+}
+
+// Export executes the query and writes the result set to w in the format, such as CSV, JSON, LTSV, FIXED or GFM.
+// The output and the flags of the connection are not changed.
+// If the result set is empty and the format cannot represent it, nothing is written.
+func (c *Conn) Export(ctx context.Context, queryString string, w io.Writer, format string, options *ExportOptions, args []driver.NamedValue) error {
+	if c.proc == nil {
+		return driver.ErrBadConn
+	}
+
+	ops := c.proc.Tx.Flags.ExportOptions.Copy()
+	ops.Color = false
+
+	var err error
+	if ops.Format, ops.JsonEscape, err = option.ParseFormat(format, ops.JsonEscape); err != nil {
+		return err
+	}
+	if err = options.apply(&ops); err != nil {
+		return err
+	}
+
+	if _, err = c.exec(contextForShowResults(ctx), OperationQuery, queryString, args); err != nil {
+		return err
+	}
+
+	views := c.proc.Tx.SelectedViews
+	if len(views) != 1 {
+		return fmt.Errorf("query must return one result set, but returned %d", len(views))
+	}
+
+	if _, err = query.EncodeView(ctx, w, views[0], ops, c.proc.Tx.Palette); err != nil {
+		if errors.Is(err, query.EmptyResultSetError) || errors.Is(err, query.DataEmpty) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Export executes the query through the connection and writes the result set to w in the format.
+func Export(ctx context.Context, conn *sql.Conn, queryString string, w io.Writer, format string, options *ExportOptions, args ...interface{}) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		c := driverConn.(*Conn)
+
+		namedArgs, err := namedValues(args)
+		if err != nil {
+			return err
+		}
+		return c.Export(ctx, queryString, w, format, options, namedArgs)
+	})
+}
+
+// ExportFile executes the query through the connection and writes the result set to the file in the format.
+// The result set is written to a temporary file in the same directory, and the file is replaced only if the export succeeds.
+func ExportFile(ctx context.Context, conn *sql.Conn, queryString string, path string, format string, options *ExportOptions, args ...interface{}) error {
+	return writeFileAtomically(path, func(w io.Writer) error {
+		return Export(ctx, conn, queryString, w, format, options, args...)
+	}, nil)
+}
+
+// namedValues converts arguments in the same way as database/sql does for the driver.
+func namedValues(args []interface{}) ([]driver.NamedValue, error) {
+	nvs := make([]driver.NamedValue, 0, len(args))
+	for i, arg := range args {
+		nv := driver.NamedValue{Ordinal: i + 1, Value: arg}
+		if named, ok := arg.(sql.NamedArg); ok {
+			nv.Name = named.Name
+			nv.Value = named.Value
+		}
+
+		if valuer, ok := nv.Value.(driver.Valuer); ok && !IsCsvqValue(nv.Value) {
+			v, err := valuer.Value()
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i+1, err)
+			}
+			nv.Value = v
+		}
+
+		v, err := (ValueConverter{}).ConvertValue(nv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		nv.Value = v
+		nvs = append(nvs, nv)
+	}
+	return nvs, nil
+}
@@ -0,0 +1,191 @@
+package csvq
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var exportTests = []struct {
+	Name    string
+	Query   string
+	Args    []interface{}
+	Format  string
+	Options *ExportOptions
+	Expect  string
+	Error   string
+}{
+	{
+		Name:   "JSON",
+		Query:  "SELECT INTEGER(col1) AS col1, col2 FROM `table.csv` WHERE col1 < ?",
+		Args:   []interface{}{3},
+		Format: "JSON",
+		Expect: "[\n" +
+			"  {\n" +
+			"    \"col1\": 1,\n" +
+			"    \"col2\": \"str1\"\n" +
+			"  },\n" +
+			"  {\n" +
+			"    \"col1\": 2,\n" +
+			"    \"col2\": \"str2\"\n" +
+			"  }\n" +
+			"]",
+		Options: &ExportOptions{PrettyPrint: true},
+	},
+	{
+		Name:   "LTSV",
+		Query:  "SELECT col1, col2 FROM `table.csv` WHERE col1 = 1",
+		Format: "ltsv",
+		Expect: "col1:1\tcol2:str1",
+	},
+	{
+		Name:    "CSV with Options",
+		Query:   "SELECT col1, col2 FROM `table.csv` WHERE col1 = 1",
+		Format:  "CSV",
+		Options: &ExportOptions{Delimiter: ";", EncloseAll: true, LineBreak: "CRLF"},
+		Expect:  "\"col1\";\"col2\"\r\n\"1\";\"str1\"",
+	},
+	{
+		Name:   "GFM",
+		Query:  "SELECT col1, col2 FROM `table.csv` WHERE col1 = 1",
+		Format: "GFM",
+		Expect: "| col1 | col2 |\n" +
+			"| ---- | ---- |\n" +
+			"| 1    | str1 |",
+	},
+	{
+		Name:   "Empty Result Set",
+		Query:  "SELECT col1 FROM `table.csv` WHERE col1 = 0",
+		Format: "TEXT",
+		Expect: "",
+	},
+	{
+		Name:   "Invalid Format",
+		Query:  "SELECT col1 FROM `table.csv`",
+		Format: "XML",
+		Error:  "format must be one of CSV|TSV|FIXED|JSON|JSONL|LTSV|GFM|ORG|BOX|TEXT",
+	},
+	{
+		Name:   "No Result Set",
+		Query:  "VAR @a := 1",
+		Format: "CSV",
+		Error:  "query must return one result set, but returned 0",
+	},
+}
+
+func TestExport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for _, v := range exportTests {
+		buf := &bytes.Buffer{}
+		err := Export(ctx, conn, v.Query, buf, v.Format, v.Options, v.Args...)
+		if err != nil {
+			if len(v.Error) < 1 {
+				t.Errorf("%s: unexpected error %q", v.Name, err)
+			} else if err.Error() != v.Error {
+				t.Errorf("%s: error %q, want error %q", v.Name, err.Error(), v.Error)
+			}
+			continue
+		}
+		if 0 < len(v.Error) {
+			t.Errorf("%s: no error, want error %q", v.Name, v.Error)
+			continue
+		}
+		if buf.String() != v.Expect {
+			t.Errorf("%s: output = %q, want %q", v.Name, buf.String(), v.Expect)
+		}
+	}
+
+	var format string
+	if err := conn.QueryRowContext(ctx, "SELECT @@FORMAT").Scan(&format); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if format != "TEXT" {
+		t.Fatalf("@@FORMAT = %q, want %q", format, "TEXT")
+	}
+}
+
+func TestExportFile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	path := filepath.Join(TestDir, "export.jsonl")
+	if err := ExportFile(ctx, conn, "SELECT col2 FROM `table.csv`", path, "JSONL", nil); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	b, _ := os.ReadFile(path)
+	expect := "{\"col2\":\"str1\"}\n{\"col2\":\"str2\"}\n{\"col2\":\"str3\"}\n"
+	if string(b) != expect {
+		t.Fatalf("file = %q, want %q", string(b), expect)
+	}
+}
+
+func TestExportFile_Error(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "export.csv")
+	expect := "col2\nexported\n"
+	if err := os.WriteFile(path, []byte(expect), 0644); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	if err := ExportFile(ctx, conn, "SELECT notexist FROM `table.csv`", path, "CSV", nil); err == nil {
+		t.Fatal("no error, want error")
+	}
+	if b, _ := os.ReadFile(path); string(b) != expect {
+		t.Errorf("file = %q, want %q", string(b), expect)
+	}
+
+	if err := ExportFile(ctx, conn, "SELECT notexist FROM `table.csv`", filepath.Join(dir, "new.csv"), "CSV", nil); err == nil {
+		t.Fatal("no error, want error")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("files = %d, want %d", len(entries), 1)
+	}
+}
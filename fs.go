@@ -0,0 +1,367 @@
+package csvq
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrReadOnlyFS = errors.New("file system is read-only")
+
+// ErrFSConflict is returned when a committed table cannot be written to the file system
+// because the file has been changed in the file system since it was staged.
+var ErrFSConflict = errors.New("file has been changed in the file system")
+
+// WritableFS is a file system that created and updated tables are written to.
+type WritableFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func newFileState(info fs.FileInfo) fileState {
+	return fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
+
+// fsRepository serves the tables in a file system to csvq, which reads and writes files in the os file system.
+// Tables are copied from the file system to a staging directory before they are loaded,
+// and tables changed in the staging directory are written back to the file system after they are committed.
+type fsRepository struct {
+	fsys fs.FS
+	root string
+	dir  string
+	// mu is shared by the connections of a connector to serialize the writes to the file system.
+	mu *sync.Mutex
+
+	// sources holds the states of the files in the file system when they were staged or written back.
+	sources map[string]fileState
+	// staged holds the states of the files in the staging directory when they were staged or written back.
+	staged map[string]fileState
+}
+
+func newFSRepository(fsys fs.FS, repository string, mu *sync.Mutex) (*fsRepository, error) {
+	root := path.Clean(filepath.ToSlash(repository))
+	if len(repository) < 1 {
+		root = "."
+	}
+	if !fs.ValidPath(root) {
+		return nil, fmt.Errorf("invalid repository %q: not a valid path in the file system", repository)
+	}
+
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository %q: %w", repository, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid repository %q: not a directory", repository)
+	}
+
+	dir, err := os.MkdirTemp("", "csvq-driver-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsRepository{
+		fsys:    fsys,
+		root:    root,
+		dir:     dir,
+		mu:      mu,
+		sources: make(map[string]fileState),
+		staged:  make(map[string]fileState),
+	}, nil
+}
+
+func (r *fsRepository) writable() bool {
+	_, ok := r.fsys.(WritableFS)
+	return ok
+}
+
+func (r *fsRepository) fsPath(name string) string {
+	return path.Join(r.root, name)
+}
+
+func (r *fsRepository) stagedPath(name string) string {
+	return filepath.Join(r.dir, filepath.FromSlash(name))
+}
+
+// resolve returns the name of the file in the file system that the table identifier refers to.
+// As with csvq, the extension of the file name can be omitted.
+func (r *fsRepository) resolve(identifier string) (string, bool) {
+	if filepath.IsAbs(identifier) {
+		return "", false
+	}
+
+	name := path.Clean(filepath.ToSlash(identifier))
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+
+	candidates := []string{name}
+	if len(path.Ext(name)) < 1 {
+		for _, ext := range tableExtensions {
+			candidates = append(candidates, name+ext)
+		}
+	}
+
+	for _, c := range candidates {
+		if info, err := fs.Stat(r.fsys, r.fsPath(c)); err == nil && !info.IsDir() {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// stage copies the file and its schema file to the staging directory unless the staged files are up to date.
+// The file is not replaced if inUse reports that the staged file is loaded by the transaction.
+func (r *fsRepository) stage(name string, inUse func(path string) bool) error {
+	info, err := fs.Stat(r.fsys, r.fsPath(name))
+	if err != nil {
+		return err
+	}
+	if err = r.stageSchemaFile(name); err != nil {
+		return err
+	}
+
+	if state, ok := r.sources[name]; ok && state == newFileState(info) {
+		return nil
+	}
+	if _, ok := r.sources[name]; ok && inUse(r.stagedPath(name)) {
+		return nil
+	}
+	return r.copy(name, info)
+}
+
+// stageSchemaFile copies the schema file of the table to the staging directory, or removes the staged schema file
+// if the schema file has been removed from the file system.
+func (r *fsRepository) stageSchemaFile(table string) error {
+	name := table + SchemaFileSuffix
+	info, err := fs.Stat(r.fsys, r.fsPath(name))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if _, ok := r.sources[name]; ok {
+			delete(r.sources, name)
+			delete(r.staged, name)
+			if err = os.Remove(r.stagedPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if state, ok := r.sources[name]; ok && state == newFileState(info) {
+		return nil
+	}
+	return r.copy(name, info)
+}
+
+func (r *fsRepository) copy(name string, info fs.FileInfo) error {
+	b, err := fs.ReadFile(r.fsys, r.fsPath(name))
+	if err != nil {
+		return err
+	}
+	p := r.stagedPath(name)
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(p, b, 0644); err != nil {
+		return err
+	}
+
+	staged, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	r.sources[name] = newFileState(info)
+	r.staged[name] = newFileState(staged)
+	return nil
+}
+
+// stageAll copies all the tables in the repository to the staging directory.
+func (r *fsRepository) stageAll(inUse func(path string) bool) error {
+	entries, err := fs.ReadDir(r.fsys, r.root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isTableFile(entry.Name()) || strings.HasSuffix(entry.Name(), SchemaFileSuffix) {
+			continue
+		}
+		if err := r.stage(entry.Name(), inUse); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedFiles returns the names of the tables that are created or updated in the staging directory.
+// Tables for which uncommitted reports true are excluded.
+func (r *fsRepository) changedFiles(uncommitted func(path string) bool) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(r.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isTableFile(d.Name()) || strings.HasSuffix(d.Name(), SchemaFileSuffix) || uncommitted(p) {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if state, ok := r.staged[name]; !ok || state != newFileState(info) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// sync writes the tables committed in the staging directory back to the file system.
+// If a file has been changed in the file system since it was staged, such as by another connection,
+// the file is not overwritten and the staged file is discarded, and ErrFSConflict is returned with the names of the files.
+// The returned names are the names of the files in the staging directory.
+func (r *fsRepository) sync(uncommitted func(path string) bool) ([]string, error) {
+	names, err := r.changedFiles(uncommitted)
+	if err != nil || len(names) < 1 {
+		return nil, err
+	}
+
+	wfs, ok := r.fsys.(WritableFS)
+	if !ok {
+		return nil, ErrReadOnlyFS
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var conflicts []string
+	for _, name := range names {
+		p := r.stagedPath(name)
+		if r.changedInFS(name) {
+			delete(r.sources, name)
+			delete(r.staged, name)
+			conflicts = append(conflicts, p)
+			continue
+		}
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return conflicts, err
+		}
+		if err = wfs.WriteFile(r.fsPath(name), b, 0644); err != nil {
+			return conflicts, err
+		}
+
+		if info, err := fs.Stat(r.fsys, r.fsPath(name)); err == nil {
+			r.sources[name] = newFileState(info)
+		}
+		if info, err := os.Stat(p); err == nil {
+			r.staged[name] = newFileState(info)
+		}
+	}
+	if 0 < len(conflicts) {
+		return conflicts, fmt.Errorf("cannot write %s: %w", strings.Join(conflicts, ", "), ErrFSConflict)
+	}
+	return nil, nil
+}
+
+// changedInFS reports whether the file in the file system is different from the file when it was staged.
+// Files that were not staged, such as created tables, are changed if they exist in the file system.
+func (r *fsRepository) changedInFS(name string) bool {
+	info, err := fs.Stat(r.fsys, r.fsPath(name))
+	state, staged := r.sources[name]
+	if err != nil {
+		return staged || !errors.Is(err, fs.ErrNotExist)
+	}
+	return !staged || state != newFileState(info)
+}
+
+func (r *fsRepository) close() error {
+	return os.RemoveAll(r.dir)
+}
+
+// stageTables copies the tables referred by the identifiers from the file system of the connection.
+func (c *Conn) stageTables(identifiers []string) error {
+	if c.fs == nil {
+		return nil
+	}
+
+	for _, identifier := range identifiers {
+		if c.proc.ReferenceScope.TemporaryTableExists(identifier) {
+			continue
+		}
+		name, ok := c.fs.resolve(identifier)
+		if !ok {
+			continue
+		}
+		if err := c.fs.stage(name, c.isLoaded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) isLoaded(path string) bool {
+	_, ok := c.proc.Tx.CachedViews.Load(strings.ToUpper(path))
+	return ok
+}
+
+// checkWritable returns ArchiveWriteError if the transaction has changes to files in archives,
+// ReadOnlyRepositoryError if the transaction has changes to files in repositories attached as read-only,
+// or ErrReadOnlyFS if the transaction has changes that cannot be written to the file system.
+func (c *Conn) checkWritable() error {
+	if err := c.checkArchiveWrites(); err != nil {
+		return err
+	}
+	if err := c.checkAttachedWrites(); err != nil {
+		return err
+	}
+	if c.fs == nil || c.fs.writable() || len(uncommittedFiles(c.proc.Tx)) < 1 {
+		return nil
+	}
+	return ErrReadOnlyFS
+}
+
+func (c *Conn) syncFS() error {
+	if err := c.syncCompressedFiles(); err != nil {
+		return err
+	}
+	if c.fs == nil {
+		return nil
+	}
+	conflicts, err := c.fs.sync(c.isUncommitted)
+	for _, p := range conflicts {
+		// The committed tables are discarded so that the tables are staged again from the file system.
+		_ = c.proc.Tx.CachedViews.Dispose(c.proc.Tx.FileContainer, strings.ToUpper(p))
+		_ = os.Remove(p)
+	}
+	return err
+}
+
+func (c *Conn) isUncommitted(path string) bool {
+	key := strings.ToUpper(path)
+	created, updated := c.proc.Tx.UncommittedViews.UncommittedFiles()
+	if _, ok := created[key]; ok {
+		return true
+	}
+	_, ok := updated[key]
+	return ok
+}
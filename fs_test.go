@@ -0,0 +1,228 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type writableMapFS struct {
+	fstest.MapFS
+}
+
+func (m writableMapFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+func newTestMapFS() fstest.MapFS {
+	return fstest.MapFS{
+		"data/users.csv":  &fstest.MapFile{Data: []byte("id,name\n1,alice\n2,bob\n")},
+		"data/notes.json": &fstest.MapFile{Data: []byte("[{\"id\":1,\"note\":\"memo\"}]")},
+		"data/sub/a.csv":  &fstest.MapFile{Data: []byte("c1\n1\n")},
+	}
+}
+
+func TestWithFS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector("data", WithFS(newTestMapFS())))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := [][]interface{}{
+		{1, "alice"},
+		{2, "bob"},
+	}
+	if err := matchRows(ctx, db, expect, "SELECT INTEGER(id), name FROM users"); err != nil {
+		t.Fatal(err)
+	}
+
+	var note string
+	if err := db.QueryRowContext(ctx, "SELECT note FROM `notes.json` WHERE id = 1").Scan(&note); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if note != "memo" {
+		t.Fatalf("note = %q, want %q", note, "memo")
+	}
+
+	var c1 int
+	if err := db.QueryRowContext(ctx, "SELECT c1 FROM `sub/a.csv`").Scan(&c1); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if c1 != 1 {
+		t.Fatalf("c1 = %d, want %d", c1, 1)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	tables, err := Tables(ctx, conn)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	names := make([]string, 0, len(tables))
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"notes.json", "users.csv"}) {
+		t.Fatalf("tables = %v, want %v", names, []string{"notes.json", "users.csv"})
+	}
+}
+
+func TestWithFS_ReadOnly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	fsys := newTestMapFS()
+	db := sql.OpenDB(NewConnector("data", WithFS(fsys)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	_, err := db.ExecContext(ctx, "UPDATE users SET name = 'carol' WHERE id = 2")
+	if !errors.Is(err, ErrReadOnlyFS) {
+		t.Fatalf("error = %v, want %v", err, ErrReadOnlyFS)
+	}
+
+	expect := [][]interface{}{
+		{1, "alice"},
+		{2, "bob"},
+	}
+	if err := matchRows(ctx, db, expect, "SELECT INTEGER(id), name FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	if string(fsys["data/users.csv"].Data) != "id,name\n1,alice\n2,bob\n" {
+		t.Fatalf("file = %q, want unchanged", string(fsys["data/users.csv"].Data))
+	}
+}
+
+func TestWithFS_Writable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	fsys := writableMapFS{MapFS: newTestMapFS()}
+	db := sql.OpenDB(NewConnector("data", WithFS(fsys)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if _, err := db.ExecContext(ctx, "UPDATE users SET name = 'carol' WHERE id = 2"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if string(fsys.MapFS["data/users.csv"].Data) != "id,name\n1,alice\n2,carol\n" {
+		t.Fatalf("file = %q, want updated", string(fsys.MapFS["data/users.csv"].Data))
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, err := tx.ExecContext(ctx, "CREATE TABLE `new.csv` (c1, c2)"); err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, ok := fsys.MapFS["data/new.csv"]; ok {
+		t.Fatal("file is written before commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if f, ok := fsys.MapFS["data/new.csv"]; !ok || string(f.Data) != "c1,c2\n" {
+		t.Fatalf("file = %v, want created", f)
+	}
+
+	fsys.MapFS["data/users.csv"] = &fstest.MapFile{Data: []byte("id,name\n3,dave\n"), ModTime: time.Now().Add(time.Second)}
+	var name string
+	if err := db.QueryRowContext(ctx, "SELECT name FROM users").Scan(&name); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if name != "dave" {
+		t.Fatalf("name = %q, want the value changed in the file system", name)
+	}
+}
+
+func TestWithFS_InvalidRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector("notexist", WithFS(newTestMapFS())))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if err := db.PingContext(ctx); err == nil {
+		t.Fatal("no error, want error for a repository that does not exist")
+	}
+}
+
+func TestWithFS_Conflict(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	fsys := writableMapFS{MapFS: newTestMapFS()}
+	db := sql.OpenDB(NewConnector("data", WithFS(fsys)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET name = 'carol' WHERE id = 2"); err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	changed := "id,name\n1,alice\n2,bob\n3,dave\n"
+	fsys.MapFS["data/users.csv"] = &fstest.MapFile{Data: []byte(changed), ModTime: time.Now().Add(time.Second)}
+	if err := tx.Commit(); !errors.Is(err, ErrFSConflict) {
+		t.Fatalf("error = %v, want %v", err, ErrFSConflict)
+	}
+	if string(fsys.MapFS["data/users.csv"].Data) != changed {
+		t.Fatalf("file = %q, want %q", string(fsys.MapFS["data/users.csv"].Data), changed)
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if count != 3 {
+		t.Fatalf("count = %d, want %d", count, 3)
+	}
+}
+
+func TestWithFS_SchemaAndAliasFiles(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	fsys := newTestMapFS()
+	fsys["data/users.csv.schema.json"] = &fstest.MapFile{Data: []byte(`{"columns": [{"name": "id", "type": "INTEGER"}]}`)}
+	fsys["aliases.json"] = &fstest.MapFile{Data: []byte(`{"members": {"path": "users.csv"}}`)}
+
+	db := sql.OpenDB(NewConnector("data", WithFS(fsys), WithTableAliasFile("aliases.json")))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var id interface{}
+	if err := db.QueryRowContext(ctx, "SELECT id FROM members WHERE name = 'bob'").Scan(&id); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if id != int64(2) {
+		t.Fatalf("id = %#v, want %#v", id, int64(2))
+	}
+}
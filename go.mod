@@ -1,14 +1,15 @@
 module github.com/mithrandie/csvq-driver
 
 require (
+	github.com/klauspost/compress v1.17.2
 	github.com/mithrandie/csvq v1.18.1
+	github.com/mithrandie/go-text v1.6.0
 	github.com/mithrandie/ternary v1.1.1
 )
 
 require (
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/mithrandie/go-file/v2 v2.1.0 // indirect
-	github.com/mithrandie/go-text v1.6.0 // indirect
 	golang.org/x/crypto v0.7.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/term v0.6.0 // indirect
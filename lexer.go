@@ -0,0 +1,150 @@
+package csvq
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mithrandie/csvq/lib/option"
+)
+
+type queryTokenType int
+
+const (
+	tokenOther queryTokenType = iota
+	tokenWord
+	tokenString
+	tokenIdentifier
+	tokenComment
+	tokenVariable
+)
+
+type queryToken struct {
+	typ     queryTokenType
+	literal string
+}
+
+// tokenizeQuery splits a query string into tokens so that the query string can be rewritten
+// without changing string literals, quoted identifiers, comments and variables.
+// Joining the literals of the returned tokens restores the original query string.
+func tokenizeQuery(queryString string, ansiQuotes bool) []queryToken {
+	r := []rune(queryString)
+	tokens := make([]queryToken, 0, len(r)/2)
+
+	scanQuoted := func(i int, quote rune) int {
+		for i++; i < len(r); i++ {
+			if r[i] == '\\' {
+				i++
+				continue
+			}
+			if r[i] == quote {
+				if i+1 < len(r) && r[i+1] == quote {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+		return len(r)
+	}
+
+	for i := 0; i < len(r); {
+		c := r[i]
+		start := i
+		typ := tokenOther
+
+		switch {
+		case c == '`' || (c == '"' && ansiQuotes):
+			typ = tokenIdentifier
+			i = scanQuoted(i, c)
+		case c == '\'' || c == '"':
+			typ = tokenString
+			i = scanQuoted(i, c)
+		case c == '-' && i+1 < len(r) && r[i+1] == '-':
+			typ = tokenComment
+			for i < len(r) && r[i] != '\n' && r[i] != '\r' {
+				i++
+			}
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			typ = tokenComment
+			i += 2
+			for i < len(r) && !(r[i] == '*' && i+1 < len(r) && r[i+1] == '/') {
+				i++
+			}
+			i += 2
+			if len(r) < i {
+				i = len(r)
+			}
+		case c == '@':
+			typ = tokenVariable
+			for i++; i < len(r) && (r[i] == '@' || r[i] == '%' || r[i] == '#'); i++ {
+			}
+			if i < len(r) && r[i] == '`' {
+				i = scanQuoted(i, '`')
+			} else {
+				for i < len(r) && isWordRune(r[i]) {
+					i++
+				}
+			}
+		case isWordRune(c):
+			typ = tokenWord
+			for i < len(r) && isWordRune(r[i]) {
+				i++
+			}
+		default:
+			i++
+		}
+
+		tokens = append(tokens, queryToken{typ: typ, literal: string(r[start:i])})
+	}
+	return tokens
+}
+
+func isWordRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func joinQueryTokens(tokens []queryToken) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString(t.literal)
+	}
+	return b.String()
+}
+
+func unquoteIdentifier(literal string) string {
+	if len(literal) < 2 {
+		return literal
+	}
+	return option.UnescapeIdentifier(literal[1:len(literal)-1], rune(literal[0]))
+}
+
+// quoteQualifiedNames rewrites table names qualified by a schema, such as "schema.table", into quoted identifiers
+// that csvq can parse. The function isSchema reports whether the word before a period is a schema name.
+func quoteQualifiedNames(queryString string, ansiQuotes bool, isSchema func(name string) bool) string {
+	tokens := tokenizeQuery(queryString, ansiQuotes)
+
+	rewritten := make([]queryToken, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.typ == tokenWord && i+2 < len(tokens) && tokens[i+1].literal == "." && isSchema(t.literal) {
+			var name string
+			switch tokens[i+2].typ {
+			case tokenWord:
+				name = tokens[i+2].literal
+			case tokenIdentifier:
+				name = unquoteIdentifier(tokens[i+2].literal)
+			}
+
+			if 0 < len(name) && (i < 1 || tokens[i-1].literal != ".") {
+				rewritten = append(rewritten, queryToken{
+					typ:     tokenIdentifier,
+					literal: option.QuoteIdentifier(t.literal + "." + name),
+				})
+				i += 2
+				continue
+			}
+		}
+		rewritten = append(rewritten, t)
+	}
+	return joinQueryTokens(rewritten)
+}
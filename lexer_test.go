@@ -0,0 +1,41 @@
+package csvq
+
+import (
+	"strings"
+	"testing"
+)
+
+var quoteQualifiedNamesTests = []struct {
+	Query  string
+	Expect string
+}{
+	{
+		Query:  "SELECT * FROM information_schema.tables",
+		Expect: "SELECT * FROM `information_schema.tables`",
+	},
+	{
+		Query:  "SELECT * FROM INFORMATION_SCHEMA.`columns` c WHERE c.table_name = 'information_schema.tables'",
+		Expect: "SELECT * FROM `INFORMATION_SCHEMA.columns` c WHERE c.table_name = 'information_schema.tables'",
+	},
+	{
+		Query:  "SELECT t.col1 FROM `table.csv` t -- information_schema.tables",
+		Expect: "SELECT t.col1 FROM `table.csv` t -- information_schema.tables",
+	},
+	{
+		Query:  "SELECT a.information_schema.tables",
+		Expect: "SELECT a.information_schema.tables",
+	},
+}
+
+func TestQuoteQualifiedNames(t *testing.T) {
+	isSchema := func(name string) bool {
+		return strings.EqualFold(name, "information_schema")
+	}
+
+	for _, v := range quoteQualifiedNamesTests {
+		result := quoteQualifiedNames(v.Query, false, isSchema)
+		if result != v.Expect {
+			t.Errorf("result = %q, want %q for %q", result, v.Expect, v.Query)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package csvq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+var ErrLimitExceeded = errors.New("resource limit exceeded")
+
+// Limits restricts the resources that an execution of statements can use. Zero values mean no limits.
+//
+// csvq loads whole tables and results in memory. MaxBytesLoaded and MaxExecutionTime are enforced in advance,
+// and MaxRowsScanned is checked against the numbers of lines in the table files before they are loaded.
+// MaxRowsReturned is a cap checked after the statements finish. An execution that exceeds it fails and its results are
+// discarded, but the memory for the rows has already been used.
+type Limits struct {
+	// MaxRowsScanned is the maximum number of rows read from tables, including the tables already loaded by the transaction.
+	MaxRowsScanned int
+	// MaxRowsReturned is the maximum number of rows in the results of queries. It does not bound the memory used.
+	MaxRowsReturned int
+	// MaxBytesLoaded is the maximum total size of the table files loaded.
+	MaxBytesLoaded int64
+	// MaxExecutionTime is the maximum time to execute the statements.
+	MaxExecutionTime time.Duration
+}
+
+// merge returns the limits with the values that are not set replaced by the values of l2.
+func (l Limits) merge(l2 Limits) Limits {
+	if l.MaxRowsScanned < 1 {
+		l.MaxRowsScanned = l2.MaxRowsScanned
+	}
+	if l.MaxRowsReturned < 1 {
+		l.MaxRowsReturned = l2.MaxRowsReturned
+	}
+	if l.MaxBytesLoaded < 1 {
+		l.MaxBytesLoaded = l2.MaxBytesLoaded
+	}
+	if l.MaxExecutionTime <= 0 {
+		l.MaxExecutionTime = l2.MaxExecutionTime
+	}
+	return l
+}
+
+const (
+	LimitRowsScanned   = "rows scanned"
+	LimitRowsReturned  = "rows returned"
+	LimitBytesLoaded   = "bytes loaded"
+	LimitExecutionTime = "execution time"
+)
+
+// LimitError is returned when an execution exceeds one of the limits of the connection.
+// Results of the execution are discarded, and its changes are rolled back in auto-commit mode.
+type LimitError struct {
+	Limit string
+	Max   string
+}
+
+func NewLimitError(limit string, max string) error {
+	return &LimitError{
+		Limit: limit,
+		Max:   max,
+	}
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("%s: %s exceeds the maximum %s", ErrLimitExceeded.Error(), e.Limit, e.Max)
+}
+
+func (e LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// withTimeout returns the context canceled when the maximum execution time elapses.
+func (l Limits) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.MaxExecutionTime <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, l.MaxExecutionTime)
+}
+
+// timeoutError returns a LimitError if the error is caused by the maximum execution time of execCtx
+// instead of the deadline or the cancellation of the parent context.
+func (l Limits) timeoutError(parent context.Context, execCtx context.Context, err error) error {
+	if err != nil && parent.Err() == nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+		return NewLimitError(LimitExecutionTime, l.MaxExecutionTime.String())
+	}
+	return err
+}
+
+// checkFileSizes returns a LimitError if the total size of the table files that the statements refer to exceeds the
+// maximum bytes loaded, so that the files are not loaded. Tables already loaded by the transaction are ignored.
+func (l Limits) checkFileSizes(tx *query.Transaction, statements []parser.Statement) error {
+	if l.MaxBytesLoaded < 1 {
+		return nil
+	}
+
+	var size int64
+	for _, name := range referencedTables(statements) {
+		fpath, err := query.SearchFilePathFromAllTypes(parser.Identifier{Literal: name}, tx.Flags.Repository)
+		if err != nil {
+			continue
+		}
+		if _, ok := tx.CachedViews.Load(strings.ToUpper(fpath)); ok {
+			continue
+		}
+		size += fileSize(fpath)
+	}
+	if l.MaxBytesLoaded < size {
+		return NewLimitError(LimitBytesLoaded, fmt.Sprintf("%d", l.MaxBytesLoaded))
+	}
+	return nil
+}
+
+// cachedRows returns the number of rows in the tables that the statements refer to and the transaction has already loaded.
+// They are not loaded again, but they are counted as scanned by the statements.
+func cachedRows(tx *query.Transaction, statements []parser.Statement) int {
+	rows := 0
+	counted := make(map[string]bool)
+	for _, name := range referencedTables(statements) {
+		fpath, err := query.SearchFilePathFromAllTypes(parser.Identifier{Literal: name}, tx.Flags.Repository)
+		if err != nil {
+			continue
+		}
+		key := strings.ToUpper(fpath)
+		if counted[key] {
+			continue
+		}
+		if view, ok := tx.CachedViews.Load(key); ok {
+			rows += view.RecordLen()
+			counted[key] = true
+		}
+	}
+	return rows
+}
+
+// checkFileRows returns a LimitError if the rows in the table files that the statements refer to, estimated from
+// their lines, and the cached rows exceed the maximum rows scanned, so that the files are not loaded.
+// Line breaks in quoted fields and blank lines are counted as rows, and records in JSON files are counted after loading.
+func (l Limits) checkFileRows(tx *query.Transaction, statements []parser.Statement, cached int) error {
+	if l.MaxRowsScanned < 1 {
+		return nil
+	}
+
+	rows := cached
+	counted := make(map[string]bool)
+	for _, name := range referencedTables(statements) {
+		fpath, err := query.SearchFilePathFromAllTypes(parser.Identifier{Literal: name}, tx.Flags.Repository)
+		if err != nil {
+			continue
+		}
+		key := strings.ToUpper(fpath)
+		if counted[key] {
+			continue
+		}
+		counted[key] = true
+		if _, ok := tx.CachedViews.Load(key); ok {
+			continue
+		}
+
+		rows += estimateRows(fpath, tx.Flags.ImportOptions.NoHeader, l.MaxRowsScanned-rows)
+		if l.MaxRowsScanned < rows {
+			return NewLimitError(LimitRowsScanned, fmt.Sprintf("%d", l.MaxRowsScanned))
+		}
+	}
+	return nil
+}
+
+// estimateRows returns the number of lines in the file excluding the header.
+// Counting stops when the number exceeds max.
+func estimateRows(fpath string, noHeader bool, max int) int {
+	ext := strings.ToLower(filepath.Ext(fpath))
+	if ext == option.JsonExt {
+		return 0
+	}
+	header := ext != option.JsonlExt && ext != option.LtsvExt && !noHeader
+	if header {
+		max++
+	}
+
+	fp, err := os.Open(fpath)
+	if err != nil {
+		return 0
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	lines := 0
+	last := byte('\n')
+	buf := make([]byte, 32*1024)
+	for lines <= max {
+		n, err := fp.Read(buf)
+		if 0 < n {
+			lines += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err != nil {
+			break
+		}
+	}
+	if last != '\n' {
+		lines++
+	}
+
+	if header && 0 < lines {
+		lines--
+	}
+	return lines
+}
+
+// check returns a LimitError if the execution exceeds the limits.
+// Tables loaded indirectly, such as in user-defined functions and prepared statements, are also counted here.
+func (l Limits) check(tx *query.Transaction, stats *executionStats) error {
+	if 0 < l.MaxRowsScanned && l.MaxRowsScanned < stats.rowsScanned {
+		return NewLimitError(LimitRowsScanned, fmt.Sprintf("%d", l.MaxRowsScanned))
+	}
+	if 0 < l.MaxBytesLoaded && l.MaxBytesLoaded < stats.bytesRead {
+		return NewLimitError(LimitBytesLoaded, fmt.Sprintf("%d", l.MaxBytesLoaded))
+	}
+	if 0 < l.MaxRowsReturned {
+		rows := 0
+		for _, view := range tx.SelectedViews {
+			rows += view.RecordLen()
+		}
+		if l.MaxRowsReturned < rows {
+			return NewLimitError(LimitRowsReturned, fmt.Sprintf("%d", l.MaxRowsReturned))
+		}
+	}
+	return nil
+}
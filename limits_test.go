@@ -0,0 +1,204 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var limitsTests = []struct {
+	Name   string
+	Limits string
+	Query  string
+	Error  string
+}{
+	{
+		Name:   "Rows Scanned",
+		Limits: "MaxRowsScanned=3",
+		Query:  "SELECT * FROM `table_limit.csv`",
+	},
+	{
+		Name:   "Rows Scanned Exceeded",
+		Limits: "MaxRowsScanned=2",
+		Query:  "SELECT * FROM `table_limit.csv` LIMIT 1",
+		Error:  "resource limit exceeded: rows scanned exceeds the maximum 2",
+	},
+	{
+		Name:   "Rows Scanned Exceeded in Subquery",
+		Limits: "MaxRowsScanned=4",
+		Query:  "SELECT * FROM `table_limit.csv` WHERE col1 IN (SELECT col1 FROM `table_q.csv`)",
+		Error:  "resource limit exceeded: rows scanned exceeds the maximum 4",
+	},
+	{
+		Name:   "Rows Returned",
+		Limits: "MaxRowsReturned=1",
+		Query:  "SELECT * FROM `table_limit.csv` LIMIT 1",
+	},
+	{
+		Name:   "Rows Returned Exceeded",
+		Limits: "MaxRowsReturned=1",
+		Query:  "SELECT * FROM `table_limit.csv`",
+		Error:  "resource limit exceeded: rows returned exceeds the maximum 1",
+	},
+	{
+		Name:   "Bytes Loaded Exceeded",
+		Limits: "MaxBytesLoaded=10",
+		Query:  "SELECT COUNT(*) FROM `table_limit.csv`",
+		Error:  "resource limit exceeded: bytes loaded exceeds the maximum 10",
+	},
+	{
+		Name:   "Execution Time Exceeded",
+		Limits: "MaxExecutionTime=20ms",
+		Query:  "VAR @i := 0; WHILE TRUE DO @i := @i + 1; END WHILE; SELECT @i",
+		Error:  "resource limit exceeded: execution time exceeds the maximum 20ms",
+	},
+}
+
+func TestLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*waitTimeoutForTests)
+	defer cancel()
+
+	for _, v := range limitsTests {
+		db, err := sql.Open("csvq", TestDir+"?"+v.Limits)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %q", v.Name, err.Error())
+		}
+
+		rows, err := db.QueryContext(ctx, v.Query)
+		if err == nil {
+			_ = rows.Close()
+		}
+		_ = db.Close()
+
+		if err != nil {
+			if len(v.Error) < 1 {
+				t.Errorf("%s: unexpected error %q", v.Name, err.Error())
+				continue
+			}
+			if err.Error() != v.Error {
+				t.Errorf("%s: error %q, want error %q", v.Name, err.Error(), v.Error)
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("%s: error %#v is not a LimitError", v.Name, err)
+			}
+			continue
+		}
+		if 0 < len(v.Error) {
+			t.Errorf("%s: no error, want error %q", v.Name, v.Error)
+		}
+	}
+}
+
+func TestWithLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TestDir+"?MaxRowsReturned=2", WithLimits(Limits{MaxRowsReturned: 10, MaxRowsScanned: 10})))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := "resource limit exceeded: rows returned exceeds the maximum 2"
+	_, err := db.ExecContext(ctx, "UPDATE `table_limit.csv` SET col2 = 'updated'; SELECT * FROM `table_limit.csv`")
+	if err == nil || err.Error() != expect {
+		t.Fatalf("error %v, want error %q", err, expect)
+	}
+
+	b, err := os.ReadFile(filepath.Join(TestDir, "table_limit.csv"))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if expect := "col1,col2\n1,str1\n2,str2\n3,str3\n"; string(b) != expect {
+		t.Errorf("file = %q, want %q, changes are not rolled back", string(b), expect)
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `table_limit.csv` WHERE col2 = 'updated'").Scan(&count); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if count != 0 {
+		t.Errorf("count = %d, want %d", count, 0)
+	}
+
+	expect = "resource limit exceeded: rows scanned exceeds the maximum 10"
+	if _, err := db.ExecContext(ctx, "SELECT * FROM `table_limit.csv` CROSS JOIN `table_q.csv` CROSS JOIN `table_sq.csv` CROSS JOIN `table_su.csv` LIMIT 1"); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+}
+
+func TestLimits_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TestDir, WithLimits(Limits{MaxExecutionTime: time.Minute})))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	_, err := db.ExecContext(ctx, "VAR @i := 0; WHILE TRUE DO @i := @i + 1; END WHILE")
+	if err == nil {
+		t.Fatal("no error, want a context error")
+	}
+	if errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("error %q is a LimitError, want a context error", err.Error())
+	}
+}
+
+func TestLimits_CachedTables(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TestDir, WithLimits(Limits{MaxRowsScanned: 5})))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM `table_limit.csv`")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	_ = rows.Close()
+
+	expect := "resource limit exceeded: rows scanned exceeds the maximum 5"
+	rows, err = tx.QueryContext(ctx, "SELECT * FROM `table_limit.csv` CROSS JOIN `table_q.csv` LIMIT 1")
+	if err == nil {
+		_ = rows.Close()
+	}
+	if err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+}
+
+func TestLimits_RowsScannedBeforeLoading(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	// The file cannot be loaded, so the limit must be checked without loading it.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.csv"), []byte("col1,col2\n1,str1\n2\n3,str3,\"\n"), 0644); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	db := sql.OpenDB(NewConnector(dir, WithLimits(Limits{MaxRowsScanned: 2})))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := "resource limit exceeded: rows scanned exceeds the maximum 2"
+	if _, err := db.ExecContext(ctx, "SELECT * FROM broken"); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+}
@@ -0,0 +1,128 @@
+package csvq
+
+import (
+	"context"
+	"database/sql/driver"
+	"sort"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+const (
+	OperationExec     = "exec"
+	OperationQuery    = "query"
+	OperationCommit   = "commit"
+	OperationRollback = "rollback"
+)
+
+const RedactedValue = "[REDACTED]"
+
+type Logger interface {
+	Log(ctx context.Context, entry LogEntry)
+}
+
+type LoggerFunc func(ctx context.Context, entry LogEntry)
+
+func (f LoggerFunc) Log(ctx context.Context, entry LogEntry) {
+	f(ctx, entry)
+}
+
+type LogEntry struct {
+	Operation    string
+	Statement    string
+	Args         []LogArg
+	Duration     time.Duration
+	RowsReturned int
+	RowsAffected int
+	Files        []string
+	Err          error
+}
+
+type LogArg struct {
+	Name    string
+	Ordinal int
+	Value   interface{}
+}
+
+// Redactor returns the value written to logs in place of a bound argument.
+type Redactor func(arg driver.NamedValue) interface{}
+
+func RedactAll(_ driver.NamedValue) interface{} {
+	return RedactedValue
+}
+
+func NoRedaction(arg driver.NamedValue) interface{} {
+	return arg.Value
+}
+
+type logRecorder struct {
+	logger   Logger
+	redactor Redactor
+	entry    LogEntry
+	start    time.Time
+}
+
+func newLogRecorder(options *connectorOptions, operation string, statement string, args []driver.NamedValue) *logRecorder {
+	if options == nil || options.logger == nil {
+		return nil
+	}
+
+	r := &logRecorder{
+		logger:   options.logger,
+		redactor: options.redactor,
+		entry: LogEntry{
+			Operation: operation,
+			Statement: statement,
+		},
+		start: time.Now(),
+	}
+	if r.redactor == nil {
+		r.redactor = RedactAll
+	}
+
+	if 0 < len(args) {
+		r.entry.Args = make([]LogArg, 0, len(args))
+		for i := range args {
+			r.entry.Args = append(r.entry.Args, LogArg{
+				Name:    args[i].Name,
+				Ordinal: args[i].Ordinal,
+				Value:   r.redactor(args[i]),
+			})
+		}
+	}
+	return r
+}
+
+func (r *logRecorder) setResults(tx *query.Transaction) {
+	if r == nil {
+		return
+	}
+	for _, view := range tx.SelectedViews {
+		r.entry.RowsReturned += view.RecordLen()
+	}
+	r.entry.RowsAffected = tx.AffectedRows
+}
+
+func (r *logRecorder) finish(ctx context.Context, err error) {
+	if r == nil {
+		return
+	}
+	r.entry.Duration = time.Since(r.start)
+	r.entry.Err = err
+	r.logger.Log(ctx, r.entry)
+}
+
+func uncommittedFiles(tx *query.Transaction) []string {
+	created, updated := tx.UncommittedViews.UncommittedFiles()
+
+	files := make([]string, 0, len(created)+len(updated))
+	for _, info := range created {
+		files = append(files, info.Path)
+	}
+	for _, info := range updated {
+		files = append(files, info.Path)
+	}
+	sort.Strings(files)
+	return files
+}
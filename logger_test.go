@@ -0,0 +1,128 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type testLogger struct {
+	mtx     sync.Mutex
+	entries []LogEntry
+}
+
+func (l *testLogger) Log(_ context.Context, entry LogEntry) {
+	l.mtx.Lock()
+	l.entries = append(l.entries, entry)
+	l.mtx.Unlock()
+}
+
+func (l *testLogger) last() LogEntry {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.entries[len(l.entries)-1]
+}
+
+func TestLogger(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	logger := &testLogger{}
+	db := sql.OpenDB(NewConnector(TestDir, WithLogger(logger)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	queryString := "SELECT INTEGER(col1) AS col1, col2 FROM `table_log.csv` WHERE col1 = ?"
+	err := matchRows(ctx, db, [][]interface{}{{1, "str1"}}, queryString, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := logger.last()
+	expect := LogEntry{
+		Operation:    OperationQuery,
+		Statement:    queryString,
+		Args:         []LogArg{{Ordinal: 1, Value: RedactedValue}},
+		RowsReturned: 1,
+		Files:        []string{"table_log.csv"},
+	}
+	entry.Duration = 0
+	if !reflect.DeepEqual(entry, expect) {
+		t.Fatalf("log entry = %#v, want %#v", entry, expect)
+	}
+
+	queryString = "SELECT FROM `table_log.csv`"
+	_, err = db.ExecContext(ctx, queryString)
+	if err == nil {
+		t.Fatal("no error, want error")
+	}
+	entry = logger.last()
+	if entry.Operation != OperationExec || entry.Err != err {
+		t.Fatalf("log entry = %#v, want exec operation with error %q", entry, err.Error())
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	queryString = "UPDATE `table_log.csv` SET col2 = 'updated' WHERE col1 = 2"
+	if _, err = tx.ExecContext(ctx, queryString); err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	entry = logger.last()
+	if entry.RowsAffected != 1 {
+		t.Fatalf("rows affected = %d, want %d", entry.RowsAffected, 1)
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	entry = logger.last()
+	if entry.Operation != OperationCommit || len(entry.Files) != 1 || entry.Err != nil {
+		t.Fatalf("log entry = %#v, want commit of 1 file", entry)
+	}
+}
+
+func TestLogger_Redactor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	logger := &testLogger{}
+	redactor := func(arg driver.NamedValue) interface{} {
+		if arg.Name == "secret" {
+			return RedactedValue
+		}
+		return arg.Value
+	}
+	db := sql.OpenDB(NewConnector(TestDir, WithLogger(logger), WithRedactor(redactor)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	stmt, err := db.PrepareContext(ctx, "SELECT INTEGER(col1) AS col1, col2 FROM `table_log.csv` WHERE col1 = :id AND col2 <> :secret")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	rs, err := stmt.QueryContext(ctx, sql.Named("id", 3), sql.Named("secret", "pw"))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	_ = rs.Close()
+
+	expect := []LogArg{
+		{Name: "id", Ordinal: 1, Value: 3},
+		{Name: "secret", Ordinal: 2, Value: RedactedValue},
+	}
+	if args := logger.last().Args; !reflect.DeepEqual(args, expect) {
+		t.Fatalf("args = %#v, want %#v", args, expect)
+	}
+}
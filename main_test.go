@@ -14,6 +14,9 @@ import (
 
 var TestDir = filepath.Join(os.TempDir(), "csvq_driver")
 var TestDataDir string
+var SchemaTestDir = filepath.Join(TestDir, "schema")
+var TableSchemaTestDir = filepath.Join(TestDir, "table_schema")
+var ArchiveTestDir = filepath.Join(TestDir, "archive")
 
 var waitTimeoutForTests = 100 * time.Millisecond
 
@@ -46,6 +49,25 @@ func setup() {
 	_ = copyfile(filepath.Join(TestDir, "table_su.csv"), filepath.Join(TestDataDir, "table.csv"))
 	_ = copyfile(filepath.Join(TestDir, "table_txc.csv"), filepath.Join(TestDataDir, "table.csv"))
 	_ = copyfile(filepath.Join(TestDir, "table_txr.csv"), filepath.Join(TestDataDir, "table.csv"))
+	_ = copyfile(filepath.Join(TestDir, "table_log.csv"), filepath.Join(TestDataDir, "table.csv"))
+	_ = copyfile(filepath.Join(TestDir, "table_trace.csv"), filepath.Join(TestDataDir, "table.csv"))
+	_ = copyfile(filepath.Join(TestDir, "table_metrics.csv"), filepath.Join(TestDataDir, "table.csv"))
+	_ = copyfile(filepath.Join(TestDir, "table_bulk.csv"), filepath.Join(TestDataDir, "table.csv"))
+	_ = copyfile(filepath.Join(TestDir, "table_limit.csv"), filepath.Join(TestDataDir, "table.csv"))
+
+	_ = os.Mkdir(SchemaTestDir, 0755)
+	_ = copyfile(filepath.Join(SchemaTestDir, "table.csv"), filepath.Join(TestDataDir, "table.csv"))
+	_ = copyfile(filepath.Join(SchemaTestDir, "types.csv"), filepath.Join(TestDataDir, "types.csv"))
+
+	_ = os.Mkdir(TableSchemaTestDir, 0755)
+	_ = copyfile(filepath.Join(TableSchemaTestDir, "table.csv"), filepath.Join(TestDataDir, "table.csv"))
+	_ = copyfile(filepath.Join(TableSchemaTestDir, "typed.csv"), filepath.Join(TestDataDir, "typed.csv"))
+	_ = copyfile(filepath.Join(TableSchemaTestDir, "typed.csv"+SchemaFileSuffix), filepath.Join(TestDataDir, "typed.csv"+SchemaFileSuffix))
+
+	_ = os.Mkdir(ArchiveTestDir, 0755)
+	_ = copyfile(filepath.Join(ArchiveTestDir, "table.csv.bz2"), filepath.Join(TestDataDir, "table.csv.bz2"))
+	_ = copyfile(filepath.Join(ArchiveTestDir, "table.csv.zst"), filepath.Join(TestDataDir, "table.csv.zst"))
+	_ = createArchiveFiles(ArchiveTestDir, filepath.Join(TestDataDir, "table.csv"))
 }
 
 func teardown() {
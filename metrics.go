@@ -0,0 +1,326 @@
+package csvq
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/file"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// Metrics receives measurements of the driver's operations.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveLockWait is called after an execution with the time spent acquiring the locks of the files
+	// that other processes held, and the number of times the locks failed to be acquired.
+	ObserveLockWait(operation string, wait time.Duration, retries int)
+	// ObserveExecution is called after an operation with the time spent on the operation excluding lock waiting.
+	ObserveExecution(operation string, duration time.Duration, err error)
+	AddRowsScanned(n int)
+	AddRowsReturned(n int)
+	AddBytesRead(n int64)
+	AddBytesWritten(n int64)
+	AddOpenConnections(delta int)
+}
+
+var durationBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Histogram is an expvar.Var that counts observed durations in cumulative buckets.
+type Histogram struct {
+	mtx     sync.Mutex
+	buckets []time.Duration
+	counts  []int64
+	count   int64
+	sum     time.Duration
+}
+
+func NewHistogram(buckets []time.Duration) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]int64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	i := 0
+	for i < len(h.buckets) && h.buckets[i] < d {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+}
+
+func (h *Histogram) Count() int64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.count
+}
+
+func (h *Histogram) String() string {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	buckets := make(map[string]int64, len(h.counts))
+	cumulative := int64(0)
+	for i := range h.counts {
+		cumulative += h.counts[i]
+		key := "+Inf"
+		if i < len(h.buckets) {
+			key = strconv.FormatFloat(h.buckets[i].Seconds(), 'f', -1, 64)
+		}
+		buckets[key] = cumulative
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"count":   h.count,
+		"sum":     h.sum.Seconds(),
+		"buckets": buckets,
+	})
+	return string(b)
+}
+
+// ExpvarMetrics is an implementation of Metrics that publishes the measurements as expvar variables.
+type ExpvarMetrics struct {
+	vars *expvar.Map
+
+	LockWait        *Histogram
+	LockRetries     *expvar.Int
+	Executions      *expvar.Map
+	ExecutionErrors *expvar.Map
+	ExecutionTime   *Histogram
+	RowsScanned     *expvar.Int
+	RowsReturned    *expvar.Int
+	BytesRead       *expvar.Int
+	BytesWritten    *expvar.Int
+	OpenConnections *expvar.Int
+}
+
+// NewExpvarMetrics creates an ExpvarMetrics and publishes it as an expvar.Map with the name.
+// As with expvar.Publish, it panics if the name is already registered.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return newExpvarMetrics(expvar.NewMap(name))
+}
+
+func newExpvarMetrics(vars *expvar.Map) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		vars:            vars,
+		LockWait:        NewHistogram(durationBuckets),
+		LockRetries:     new(expvar.Int),
+		Executions:      new(expvar.Map).Init(),
+		ExecutionErrors: new(expvar.Map).Init(),
+		ExecutionTime:   NewHistogram(durationBuckets),
+		RowsScanned:     new(expvar.Int),
+		RowsReturned:    new(expvar.Int),
+		BytesRead:       new(expvar.Int),
+		BytesWritten:    new(expvar.Int),
+		OpenConnections: new(expvar.Int),
+	}
+
+	m.vars.Set("lock_wait_seconds", m.LockWait)
+	m.vars.Set("lock_retries", m.LockRetries)
+	m.vars.Set("executions", m.Executions)
+	m.vars.Set("execution_errors", m.ExecutionErrors)
+	m.vars.Set("execution_seconds", m.ExecutionTime)
+	m.vars.Set("rows_scanned", m.RowsScanned)
+	m.vars.Set("rows_returned", m.RowsReturned)
+	m.vars.Set("bytes_read", m.BytesRead)
+	m.vars.Set("bytes_written", m.BytesWritten)
+	m.vars.Set("open_connections", m.OpenConnections)
+	return m
+}
+
+func (m *ExpvarMetrics) ObserveLockWait(_ string, wait time.Duration, retries int) {
+	m.LockWait.Observe(wait)
+	m.LockRetries.Add(int64(retries))
+}
+
+func (m *ExpvarMetrics) ObserveExecution(operation string, duration time.Duration, err error) {
+	m.Executions.Add(operation, 1)
+	if err != nil {
+		m.ExecutionErrors.Add(operation, 1)
+	}
+	m.ExecutionTime.Observe(duration)
+}
+
+func (m *ExpvarMetrics) AddRowsScanned(n int) {
+	m.RowsScanned.Add(int64(n))
+}
+
+func (m *ExpvarMetrics) AddRowsReturned(n int) {
+	m.RowsReturned.Add(int64(n))
+}
+
+func (m *ExpvarMetrics) AddBytesRead(n int64) {
+	m.BytesRead.Add(n)
+}
+
+func (m *ExpvarMetrics) AddBytesWritten(n int64) {
+	m.BytesWritten.Add(n)
+}
+
+func (m *ExpvarMetrics) AddOpenConnections(delta int) {
+	m.OpenConnections.Add(int64(delta))
+}
+
+type metricsRecorder struct {
+	metrics   Metrics
+	operation string
+	start     time.Time
+	lockWait  time.Duration
+}
+
+func newMetricsRecorder(options *connectorOptions, operation string) *metricsRecorder {
+	if options == nil || options.metrics == nil {
+		return nil
+	}
+	return &metricsRecorder{
+		metrics:   options.metrics,
+		operation: operation,
+		start:     time.Now(),
+	}
+}
+
+func (r *metricsRecorder) observeStats(stats *executionStats) {
+	if r == nil || stats == nil {
+		return
+	}
+	r.lockWait = stats.lockWait
+	r.metrics.ObserveLockWait(r.operation, stats.lockWait, stats.lockRetries)
+	r.metrics.AddRowsScanned(stats.rowsScanned)
+	r.metrics.AddBytesRead(stats.bytesRead)
+	r.metrics.AddBytesWritten(stats.bytesWritten)
+}
+
+func (r *metricsRecorder) observeResults(tx *query.Transaction) {
+	if r == nil {
+		return
+	}
+	rows := 0
+	for _, view := range tx.SelectedViews {
+		rows += view.RecordLen()
+	}
+	r.metrics.AddRowsReturned(rows)
+}
+
+func (r *metricsRecorder) finish(err error) {
+	if r == nil {
+		return
+	}
+	r.metrics.ObserveExecution(r.operation, time.Since(r.start)-r.lockWait, err)
+}
+
+// acquireFileLocks acquires the locks of the files that the statements read or write in the same way as csvq does,
+// and releases them before the execution, so that the time spent waiting for other processes to release the locks
+// is measured separately from the execution. Files that are written by the statements are locked exclusively.
+// It returns the time spent and the number of times the locks failed to be acquired.
+// Errors are not returned, the processor reports them when it acquires the locks.
+func acquireFileLocks(ctx context.Context, tx *query.Transaction, statements []parser.Statement) (time.Duration, int) {
+	held := make(map[string]bool)
+	for _, key := range tx.FileContainer.Keys() {
+		held[key] = true
+	}
+	for _, key := range tx.CachedViews.Keys() {
+		held[key] = true
+	}
+	written := writtenTables(statements)
+
+	start := time.Now()
+	ctx, cancel := file.GetTimeoutContext(ctx, tx.WaitTimeout)
+	defer cancel()
+
+	retries := 0
+	for _, name := range referencedTables(statements) {
+		fpath, err := query.SearchFilePathFromAllTypes(parser.Identifier{Literal: name}, tx.Flags.Repository)
+		if err != nil || held[strings.ToUpper(fpath)] {
+			continue
+		}
+		held[strings.ToUpper(fpath)] = true
+
+		tryLock := file.TryCreateRLockFile
+		if written[strings.ToUpper(name)] {
+			tryLock = file.TryCreateLockFile
+		}
+		for {
+			lock, err := tryLock(fpath)
+			if err == nil {
+				_ = lock.Close()
+				break
+			}
+			if _, ok := err.(*file.LockError); !ok {
+				break
+			}
+			retries++
+			select {
+			case <-ctx.Done():
+				return time.Since(start), retries
+			case <-time.After(tx.RetryDelay):
+			}
+		}
+	}
+	return time.Since(start), retries
+}
+
+// writtenTables returns the upper-cased identifiers of the tables that the statements write.
+func writtenTables(statements []parser.Statement) map[string]bool {
+	tables := make(map[string]bool)
+	add := func(exprs ...parser.QueryExpression) {
+		for _, expr := range exprs {
+			if t, ok := expr.(parser.Table); ok {
+				expr = t.Object
+			}
+			if name, ok := tableObjectName(expr); ok {
+				tables[strings.ToUpper(name)] = true
+			}
+		}
+	}
+
+	walkStatements(statements, func(node interface{}) bool {
+		switch n := node.(type) {
+		case parser.InsertQuery:
+			add(n.Table)
+		case parser.ReplaceQuery:
+			add(n.Table)
+		case parser.UpdateQuery:
+			add(n.Tables...)
+		case parser.DeleteQuery:
+			add(n.Tables...)
+		case parser.AddColumns:
+			add(n.Table)
+		case parser.DropColumns:
+			add(n.Table)
+		case parser.RenameColumn:
+			add(n.Table)
+		case parser.SetTableAttribute:
+			add(n.Table)
+		}
+		return true
+	})
+	return tables
+}
+
+func fileSize(fpath string) int64 {
+	if fi, err := os.Stat(fpath); err == nil {
+		return fi.Size()
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/file"
+)
+
+func TestExpvarMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	metrics := newExpvarMetrics(new(expvar.Map).Init())
+	db := sql.OpenDB(NewConnector(TestDir, WithMetrics(metrics)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	queryString := "SELECT INTEGER(col1) AS col1, col2 FROM `table_metrics.csv` WHERE col1 = 1"
+	if err := matchRows(ctx, db, [][]interface{}{{1, "str1"}}, queryString); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := metrics.OpenConnections.Value(); v != 1 {
+		t.Fatalf("open connections = %d, want %d", v, 1)
+	}
+	if v := metrics.RowsScanned.Value(); v != 3 {
+		t.Fatalf("rows scanned = %d, want %d", v, 3)
+	}
+	if v := metrics.RowsReturned.Value(); v != 1 {
+		t.Fatalf("rows returned = %d, want %d", v, 1)
+	}
+	if v := metrics.BytesRead.Value(); v <= 0 {
+		t.Fatalf("bytes read = %d, want positive value", v)
+	}
+	if v := metrics.LockWait.Count(); v != 1 {
+		t.Fatalf("lock wait observations = %d, want %d", v, 1)
+	}
+	if v := metrics.LockRetries.Value(); v != 0 {
+		t.Fatalf("lock retries = %d, want %d", v, 0)
+	}
+
+	// Another process reads the file, so the update waits until the read lock is released.
+	rlock, err := file.TryCreateRLockFile(filepath.Join(TestDir, "table_metrics.csv"))
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = rlock.Close()
+	}()
+
+	if _, err := db.ExecContext(ctx, "UPDATE `table_metrics.csv` SET col2 = 'updated' WHERE col1 = 3"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if v := metrics.LockRetries.Value(); v < 1 {
+		t.Fatalf("lock retries = %d, want positive value", v)
+	}
+	if v := metrics.BytesWritten.Value(); v <= 0 {
+		t.Fatalf("bytes written = %d, want positive value", v)
+	}
+	if v := metrics.Executions.Get(OperationExec).String(); v != "1" {
+		t.Fatalf("exec count = %s, want %d", v, 1)
+	}
+
+	_ = db.Close()
+	if v := metrics.OpenConnections.Value(); v != 0 {
+		t.Fatalf("open connections = %d, want %d", v, 0)
+	}
+}
+
+func TestHistogram_String(t *testing.T) {
+	h := NewHistogram([]time.Duration{time.Millisecond, time.Second})
+	h.Observe(500 * time.Microsecond)
+	h.Observe(10 * time.Millisecond)
+	h.Observe(2 * time.Second)
+
+	expect := "{\"buckets\":{\"+Inf\":3,\"0.001\":1,\"1\":2},\"count\":3,\"sum\":2.0105}"
+	if s := h.String(); s != expect {
+		t.Fatalf("string = %s, want %s", s, expect)
+	}
+}
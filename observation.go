@@ -0,0 +1,50 @@
+package csvq
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// observation bundles the logging, tracing and metrics of an execution.
+type observation struct {
+	log     *logRecorder
+	span    Span
+	metrics *metricsRecorder
+}
+
+func startObservation(ctx context.Context, options *connectorOptions, operation string, queryString string, repository string, args []driver.NamedValue) (context.Context, *observation) {
+	o := &observation{
+		log:     newLogRecorder(options, operation, queryString, args),
+		metrics: newMetricsRecorder(options, operation),
+	}
+	ctx, o.span = startSpan(ctx, options, operation,
+		Attribute{Key: AttributeStatement, Value: queryString},
+		Attribute{Key: AttributeRepository, Value: repository},
+	)
+	return ctx, o
+}
+
+func (o *observation) setStatements(statements []parser.Statement) {
+	files := referencedTables(statements)
+	if o.log != nil {
+		o.log.entry.Files = files
+	}
+	o.span.SetAttributes(Attribute{Key: AttributeFiles, Value: files})
+}
+
+// finish records the results of the execution.
+// If tx is nil, the operation does not produce results such as a commit.
+func (o *observation) finish(ctx context.Context, tx *query.Transaction, stats *executionStats, err error) {
+	o.metrics.observeStats(stats)
+	if err == nil && tx != nil {
+		o.log.setResults(tx)
+		o.span.SetAttributes(resultAttributes(tx)...)
+		o.metrics.observeResults(tx)
+	}
+	o.log.finish(ctx, err)
+	o.span.End(err)
+	o.metrics.finish(err)
+}
@@ -0,0 +1,233 @@
+package csvq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+	"github.com/mithrandie/csvq/lib/value"
+)
+
+// outArgument is an argument passed as sql.Out that is bound to the user variable of the same name.
+type outArgument struct {
+	variable parser.Variable
+	out      sql.Out
+}
+
+// checkOutArgument checks the argument if it is passed as sql.Out. The second return value is false if it is not.
+func checkOutArgument(nv *driver.NamedValue) (bool, error) {
+	out, ok := nv.Value.(sql.Out)
+	if !ok {
+		return false, nil
+	}
+	if len(strings.TrimPrefix(nv.Name, "@")) < 1 {
+		return true, errors.New("output parameters must be named with the names of variables")
+	}
+	if out.Dest == nil || reflect.ValueOf(out.Dest).Kind() != reflect.Ptr || reflect.ValueOf(out.Dest).IsNil() {
+		return true, fmt.Errorf("destination of output parameter %q must be a non-nil pointer", nv.Name)
+	}
+	if out.In {
+		if _, err := outInputValue(out); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// splitOutArguments separates the arguments passed as sql.Out from the arguments bound to the placeholders.
+func splitOutArguments(args []driver.NamedValue) ([]outArgument, []driver.NamedValue) {
+	var outs []outArgument
+	var values []driver.NamedValue
+	for _, arg := range args {
+		if out, ok := arg.Value.(sql.Out); ok {
+			outs = append(outs, outArgument{
+				variable: parser.Variable{Name: strings.TrimPrefix(arg.Name, "@")},
+				out:      out,
+			})
+			continue
+		}
+		values = append(values, arg)
+	}
+	if outs == nil {
+		return nil, args
+	}
+	return outs, values
+}
+
+func outInputValue(out sql.Out) (value.Primary, error) {
+	v, err := ValueConverter{}.ConvertValue(reflect.ValueOf(out.Dest).Elem().Interface())
+	if err != nil {
+		return nil, err
+	}
+	return v.(Value).PrimitiveType().Value, nil
+}
+
+func referencesVariables(statements []parser.Statement) bool {
+	found := false
+	walkStatements(statements, func(node interface{}) bool {
+		if _, ok := node.(parser.Variable); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// bindOutArguments sets the values of the input-output parameters to the variables before the execution.
+// Variables that are not declared are declared in the connection.
+func bindOutArguments(proc *query.Processor, outs []outArgument) error {
+	for _, arg := range outs {
+		if !arg.out.In {
+			continue
+		}
+		val, err := outInputValue(arg.out)
+		if err != nil {
+			return err
+		}
+		if _, err = proc.ReferenceScope.SubstituteVariableDirectly(arg.variable, val); err != nil {
+			if err = proc.ReferenceScope.DeclareVariableDirectly(arg.variable, val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readOutArguments writes the values of the variables to the destinations of the output parameters after the execution.
+func readOutArguments(proc *query.Processor, outs []outArgument) error {
+	for _, arg := range outs {
+		val, err := proc.ReferenceScope.GetVariable(arg.variable)
+		if err != nil {
+			return err
+		}
+		if err = assignValue(arg.out.Dest, driverValue(val)); err != nil {
+			return fmt.Errorf("cannot set variable %s to output parameter: %w", arg.variable.String(), err)
+		}
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// assignValue converts the value returned by the driver to the type that dest points to and sets it.
+func assignValue(dest interface{}, src driver.Value) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(src)
+	}
+	return assignReflectValue(reflect.ValueOf(dest).Elem(), src)
+}
+
+func assignReflectValue(v reflect.Value, src driver.Value) error {
+	if src == nil {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot assign NULL to %s", v.Type())
+	}
+
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := assignValue(p.Interface(), src); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(v.Type()) {
+		v.Set(sv)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if t, ok := src.(time.Time); ok {
+			v.SetString(t.Format(time.RFC3339Nano))
+		} else {
+			v.SetString(fmt.Sprint(src))
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		switch sv.Kind() {
+		case reflect.Int64, reflect.Float64:
+			return assignNumber(v, sv)
+		}
+	}
+	if v.Type() != timeType && sv.Type().ConvertibleTo(v.Type()) && sv.Kind() == v.Kind() {
+		v.Set(sv.Convert(v.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot assign %T to %s", src, v.Type())
+}
+
+// assignNumber assigns an int64 or a float64 to a numeric value.
+// As database/sql does for the scanned values, values that overflow the destination or lose their fractional parts
+// are not assigned.
+func assignNumber(v reflect.Value, sv reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if sv.Kind() == reflect.Float64 {
+			f := sv.Float()
+			if f != math.Trunc(f) {
+				return fmt.Errorf("cannot assign %v to %s: fractional part would be lost", f, v.Type())
+			}
+			if f < math.MinInt64 || math.MaxInt64 <= f {
+				return fmt.Errorf("cannot assign %v to %s: value out of range", f, v.Type())
+			}
+			i = int64(f)
+		} else {
+			i = sv.Int()
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("cannot assign %v to %s: value out of range", sv.Interface(), v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		if sv.Kind() == reflect.Float64 {
+			f := sv.Float()
+			if f != math.Trunc(f) {
+				return fmt.Errorf("cannot assign %v to %s: fractional part would be lost", f, v.Type())
+			}
+			if f < 0 || math.MaxUint64 <= f {
+				return fmt.Errorf("cannot assign %v to %s: value out of range", f, v.Type())
+			}
+			u = uint64(f)
+		} else {
+			i := sv.Int()
+			if i < 0 {
+				return fmt.Errorf("cannot assign %v to %s: value out of range", i, v.Type())
+			}
+			u = uint64(i)
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("cannot assign %v to %s: value out of range", sv.Interface(), v.Type())
+		}
+		v.SetUint(u)
+	default:
+		var f float64
+		if sv.Kind() == reflect.Float64 {
+			f = sv.Float()
+		} else {
+			f = float64(sv.Int())
+		}
+		if v.OverflowFloat(f) {
+			return fmt.Errorf("cannot assign %v to %s: value out of range", sv.Interface(), v.Type())
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestOutArguments(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", TestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var count int
+	var name string
+	var missing *string
+	_, err = conn.ExecContext(ctx, "VAR @count := (SELECT COUNT(*) FROM `table_q.csv`), @name := 'str', @missing;",
+		sql.Named("count", sql.Out{Dest: &count}),
+		sql.Named("name", sql.Out{Dest: &name}),
+		sql.Named("missing", sql.Out{Dest: &missing}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if count != 3 || name != "str" || missing != nil {
+		t.Errorf("outputs = (%d, %q, %v), want (%d, %q, %v)", count, name, missing, 3, "str", nil)
+	}
+
+	n := int64(5)
+	if _, err = conn.ExecContext(ctx, "@n := @n * 2;", sql.Named("n", sql.Out{Dest: &n, In: true})); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if n != 10 {
+		t.Errorf("output = %d, want %d", n, 10)
+	}
+
+	stmt, err := conn.PrepareContext(ctx, "@n := @n + ?;")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, err = stmt.ExecContext(ctx, 3, sql.Named("n", sql.Out{Dest: &n, In: true})); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if n != 13 {
+		t.Errorf("output = %d, want %d", n, 13)
+	}
+	if _, err = stmt.ExecContext(ctx, sql.Named("n", sql.Out{Dest: &n, In: true})); err == nil || err.Error() != "expected 1 arguments, got 0" {
+		t.Errorf("error %v, want error %q", err, "expected 1 arguments, got 0")
+	}
+	_ = stmt.Close()
+
+	var s string
+	expect := "variable @undeclared is undeclared"
+	if _, err = conn.ExecContext(ctx, "SELECT 1", sql.Named("undeclared", sql.Out{Dest: &s})); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+	expect = "sql: converting argument $1 type: output parameters must be named with the names of variables"
+	if _, err = conn.ExecContext(ctx, "SELECT 1", sql.Out{Dest: &s}); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+}
+
+func TestAssignValue_Numbers(t *testing.T) {
+	var i8 int8
+	var u uint
+	var i int
+	var f32 float32
+	var f64 float64
+
+	tests := []struct {
+		Dest   interface{}
+		Src    interface{}
+		Result interface{}
+		Error  string
+	}{
+		{Dest: &i8, Src: int64(127), Result: int8(127)},
+		{Dest: &i8, Src: int64(128), Error: "cannot assign 128 to int8: value out of range"},
+		{Dest: &u, Src: int64(-1), Error: "cannot assign -1 to uint: value out of range"},
+		{Dest: &i, Src: float64(3), Result: 3},
+		{Dest: &i, Src: 1.5, Error: "cannot assign 1.5 to int: fractional part would be lost"},
+		{Dest: &i, Src: 1e19, Error: "cannot assign 1e+19 to int: value out of range"},
+		{Dest: &u, Src: 1e19, Result: uint(1e19)},
+		{Dest: &f32, Src: 1e39, Error: "cannot assign 1e+39 to float32: value out of range"},
+		{Dest: &f64, Src: int64(2), Result: float64(2)},
+	}
+
+	for _, v := range tests {
+		err := assignValue(v.Dest, v.Src)
+		if len(v.Error) < 1 {
+			if err != nil {
+				t.Errorf("assign %v: unexpected error %q", v.Src, err.Error())
+			} else if result := reflect.ValueOf(v.Dest).Elem().Interface(); result != v.Result {
+				t.Errorf("assign %v: result = %v, want %v", v.Src, result, v.Result)
+			}
+			continue
+		}
+		if err == nil || err.Error() != v.Error {
+			t.Errorf("assign %v: error = %v, want error %q", v.Src, err, v.Error)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package csvq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/parser"
+)
+
+// Placeholder dialects that can be specified by the DSN parameter "Placeholder".
+const (
+	// PlaceholderCsvq is the dialect of csvq, "?" and ":name".
+	PlaceholderCsvq = "csvq"
+	// PlaceholderDollar is the dialect of PostgreSQL, "$1". Each number is the ordinal of the argument.
+	PlaceholderDollar = "dollar"
+	// PlaceholderAt is the dialect of SQL Server, "@name". Variables declared or assigned in the statements,
+	// and variables already declared in the connection are not placeholders.
+	PlaceholderAt = "at"
+)
+
+func isPlaceholderDialect(s string) bool {
+	switch strings.ToLower(s) {
+	case PlaceholderCsvq, PlaceholderDollar, PlaceholderAt:
+		return true
+	}
+	return false
+}
+
+// rewritePlaceholders rewrites the placeholders of the dialect of the connection into the placeholders of csvq.
+// In the dollar dialect, placeholders are rewritten into "?", and the returned ordinals are the ordinals of the
+// arguments bound to them in order of appearance.
+func (c *Conn) rewritePlaceholders(queryString string) (string, []int, error) {
+	switch c.placeholder {
+	case PlaceholderDollar:
+		return rewriteDollarPlaceholders(queryString, c.proc.Tx.Flags.AnsiQuotes)
+	case PlaceholderAt:
+		return c.rewriteAtPlaceholders(queryString), nil, nil
+	}
+	return queryString, nil, nil
+}
+
+func rewriteDollarPlaceholders(queryString string, ansiQuotes bool) (string, []int, error) {
+	tokens := tokenizeQuery(queryString, ansiQuotes)
+
+	var ordinals []int
+	rewritten := make([]queryToken, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.typ == tokenOther && t.literal == "?" {
+			return "", nil, fmt.Errorf("placeholder \"?\" cannot be used in the placeholder dialect %q", PlaceholderDollar)
+		}
+		if t.typ == tokenOther && t.literal == "$" && i+1 < len(tokens) && tokens[i+1].typ == tokenWord {
+			if n, err := strconv.Atoi(tokens[i+1].literal); err == nil && 0 < n && tokens[i+1].literal[0] != '0' {
+				ordinals = append(ordinals, n)
+				rewritten = append(rewritten, queryToken{typ: tokenOther, literal: "?"})
+				i++
+				continue
+			}
+		}
+		rewritten = append(rewritten, t)
+	}
+	return joinQueryTokens(rewritten), ordinals, nil
+}
+
+func (c *Conn) rewriteAtPlaceholders(queryString string) string {
+	ansiQuotes := c.proc.Tx.Flags.AnsiQuotes
+
+	variables := make(map[string]bool)
+	if statements, _, err := parser.Parse(queryString, "", true, ansiQuotes); err == nil {
+		for _, name := range declaredVariables(statements) {
+			variables[name] = true
+		}
+	}
+	for _, name := range c.proc.ReferenceScope.AllVariables().Keys() {
+		variables[name] = true
+	}
+
+	tokens := tokenizeQuery(queryString, ansiQuotes)
+	for i, t := range tokens {
+		if t.typ != tokenVariable || len(t.literal) < 2 || !isWordRune([]rune(t.literal)[1]) {
+			continue
+		}
+		if name := t.literal[1:]; !variables[name] {
+			tokens[i].literal = ":" + name
+		}
+	}
+	return joinQueryTokens(tokens)
+}
+
+// variableNames returns the sorted names of the variables declared in the connection joined by commas.
+func (c *Conn) variableNames() string {
+	names := c.proc.ReferenceScope.AllVariables().Keys()
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// declaredVariables returns the names of the variables that the statements declare or assign values to.
+func declaredVariables(statements []parser.Statement) []string {
+	var names []string
+	appendVariables := func(variables ...parser.Variable) {
+		for _, v := range variables {
+			names = append(names, v.Name)
+		}
+	}
+
+	walkStatements(statements, func(node interface{}) bool {
+		switch n := node.(type) {
+		case parser.VariableAssignment:
+			appendVariables(n.Variable)
+		case parser.VariableSubstitution:
+			appendVariables(n.Variable)
+		case parser.IntoClause:
+			appendVariables(n.Variables...)
+		case parser.FetchCursor:
+			appendVariables(n.Variables...)
+		case parser.WhileInCursor:
+			appendVariables(n.Variables...)
+		}
+		return true
+	})
+	return names
+}
@@ -0,0 +1,108 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+var rewriteDollarPlaceholdersTests = []struct {
+	Query    string
+	Expect   string
+	Ordinals []int
+	Error    string
+}{
+	{
+		Query:    "SELECT * FROM `table.csv` WHERE col1 = $2 AND col2 = $1 OR col1 = $2",
+		Expect:   "SELECT * FROM `table.csv` WHERE col1 = ? AND col2 = ? OR col1 = ?",
+		Ordinals: []int{2, 1, 2},
+	},
+	{
+		Query:  "SELECT '$1', `$1.csv`.col1 FROM `$1.csv` -- $1",
+		Expect: "SELECT '$1', `$1.csv`.col1 FROM `$1.csv` -- $1",
+	},
+	{
+		Query: "SELECT $1 WHERE col1 = ?",
+		Error: "placeholder \"?\" cannot be used in the placeholder dialect \"dollar\"",
+	},
+}
+
+func TestRewriteDollarPlaceholders(t *testing.T) {
+	for _, v := range rewriteDollarPlaceholdersTests {
+		result, ordinals, err := rewriteDollarPlaceholders(v.Query, false)
+		if err != nil {
+			if len(v.Error) < 1 {
+				t.Errorf("unexpected error %q for %q", err.Error(), v.Query)
+			} else if err.Error() != v.Error {
+				t.Errorf("error %q, want error %q for %q", err.Error(), v.Error, v.Query)
+			}
+			continue
+		}
+		if 0 < len(v.Error) {
+			t.Errorf("no error, want error %q for %q", v.Error, v.Query)
+			continue
+		}
+		if result != v.Expect {
+			t.Errorf("result = %q, want %q for %q", result, v.Expect, v.Query)
+		}
+		if !reflect.DeepEqual(ordinals, v.Ordinals) {
+			t.Errorf("ordinals = %v, want %v for %q", ordinals, v.Ordinals, v.Query)
+		}
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, err := sql.Open("csvq", TestDir+"?Placeholder=dollar")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	expect := [][]interface{}{
+		{2, "str2"},
+	}
+	if err := matchRows(ctx, db, expect, "SELECT * FROM `table_q.csv` WHERE col2 = $2 AND col1 = $1 AND col1 <= $1", 2, "str2"); err != nil {
+		t.Error(err)
+	}
+	_ = db.Close()
+
+	db, err = sql.Open("csvq", TestDir+"?Placeholder=at")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.ExecContext(ctx, "VAR @declared := 3"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	expect = [][]interface{}{
+		{1, "str1"},
+		{3, "str3"},
+	}
+	queryString := "VAR @max := @declared; SELECT * FROM `table_q.csv` WHERE col1 BETWEEN @min AND @max AND col2 <> '@min' AND col2 <> @excluded"
+	if err := matchRows(ctx, conn, expect, queryString, sql.Named("min", 1), sql.Named("excluded", "str2")); err != nil {
+		t.Error(err)
+	}
+
+	queryString = "SELECT * FROM `table_q.csv` WHERE col1 = @id AND col2 <> @excluded"
+	if err := matchRows(ctx, conn, [][]interface{}{{1, "str1"}}, queryString, sql.Named("id", 1), sql.Named("excluded", "str2")); err != nil {
+		t.Error(err)
+	}
+	if _, err := conn.ExecContext(ctx, "VAR @id := 3"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if err := matchRows(ctx, conn, [][]interface{}{{3, "str3"}}, queryString, sql.Named("excluded", "str2")); err != nil {
+		t.Errorf("statement cached before the variable is declared: %s", err)
+	}
+}
@@ -0,0 +1,349 @@
+package csvq
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// PolicyError is returned when a statement is rejected by the policy of the connection.
+// Line and Char are the position of the rejected expression in the statement, or zero if the position is unknown.
+type PolicyError struct {
+	Line    int
+	Char    int
+	Message string
+}
+
+func NewPolicyError(expr parser.Expression, message string) error {
+	e := &PolicyError{
+		Message: message,
+	}
+	if expr != nil && expr.HasParseInfo() {
+		e.Line = expr.Line()
+		e.Char = expr.Char()
+	}
+	return e
+}
+
+func (e PolicyError) Error() string {
+	if 0 < e.Line {
+		return fmt.Sprintf("[L:%d C:%d] rejected by policy: %s", e.Line, e.Char, e.Message)
+	}
+	return fmt.Sprintf("rejected by policy: %s", e.Message)
+}
+
+// Policy inspects parsed statements before they are executed.
+// If Check returns an error, the statements are not executed and the error is returned to the caller.
+// Errors should be created with NewPolicyError to report the positions of the rejected expressions.
+type Policy interface {
+	Check(ctx context.Context, statements []parser.Statement) error
+}
+
+// PolicyFunc is an adapter to use a function as a Policy.
+type PolicyFunc func(ctx context.Context, statements []parser.Statement) error
+
+func (f PolicyFunc) Check(ctx context.Context, statements []parser.Statement) error {
+	return f(ctx, statements)
+}
+
+type StatementKind int
+
+const (
+	StatementQuery StatementKind = iota
+	StatementWrite
+	StatementDDL
+	StatementTransaction
+	StatementSource
+	StatementExecute
+	StatementExternalCommand
+	StatementSetFlag
+	StatementCommand
+	StatementShow
+)
+
+var statementKindNames = map[StatementKind]string{
+	StatementQuery:           "query",
+	StatementWrite:           "write",
+	StatementDDL:             "DDL",
+	StatementTransaction:     "transaction control",
+	StatementSource:          "SOURCE",
+	StatementExecute:         "EXECUTE",
+	StatementExternalCommand: "external command",
+	StatementSetFlag:         "flag setting",
+	StatementCommand:         "command",
+	StatementShow:            "SHOW",
+}
+
+func (k StatementKind) String() string {
+	if s, ok := statementKindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("StatementKind(%d)", int(k))
+}
+
+// StatementKindOf returns the kind of the statement.
+// The second return value is false if the node is not a statement that has a kind,
+// such as declarations of variables and control flow statements.
+func StatementKindOf(node interface{}) (StatementKind, bool) {
+	switch node.(type) {
+	case parser.SelectQuery:
+		return StatementQuery, true
+	case parser.InsertQuery, parser.UpdateQuery, parser.ReplaceQuery, parser.DeleteQuery:
+		return StatementWrite, true
+	case parser.CreateTable, parser.AddColumns, parser.DropColumns, parser.RenameColumn, parser.SetTableAttribute:
+		return StatementDDL, true
+	case parser.TransactionControl:
+		return StatementTransaction, true
+	case parser.Source:
+		return StatementSource, true
+	case parser.Execute:
+		return StatementExecute, true
+	case parser.ExternalCommand:
+		return StatementExternalCommand, true
+	case parser.SetFlag, parser.AddFlagElement, parser.RemoveFlagElement:
+		return StatementSetFlag, true
+	case parser.Chdir, parser.Pwd, parser.Reload:
+		return StatementCommand, true
+	case parser.ShowObjects, parser.ShowFields, parser.ShowFlag:
+		return StatementShow, true
+	}
+	return 0, false
+}
+
+// StatementPolicy is a Policy that rejects statements by their kinds, the tables they refer to and the functions they call.
+// Statements nested in control flows, user-defined functions and prepared statements are also inspected.
+// EXECUTE is allowed only with a constant string without USING, and the statements in the string are inspected.
+type StatementPolicy struct {
+	// AllowedKinds is the kinds of statements that are allowed. If empty, all kinds are allowed except DeniedKinds.
+	AllowedKinds []StatementKind
+	DeniedKinds  []StatementKind
+	// DeniedTables is the tables that cannot be referred to. Tables are compared with the identifiers in statements
+	// case-insensitively, and names without extensions match the identifiers with extensions.
+	// When the policy is checked by a connection, the tables and the identifiers are also resolved to the files
+	// in the same way as the connection reads them, with table aliases, attached schemas, extensions
+	// and absolute paths, and the identifiers that refer to the files of the tables are also rejected.
+	DeniedTables []string
+	// DeniedFunctions is the names of built-in and user-defined functions that cannot be called.
+	DeniedFunctions []string
+}
+
+func (p StatementPolicy) Check(ctx context.Context, statements []parser.Statement) error {
+	var err error
+	walkStatements(statements, func(node interface{}) bool {
+		if err == nil {
+			err = p.checkNode(ctx, node)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func (p StatementPolicy) checkNode(ctx context.Context, node interface{}) error {
+	if kind, ok := StatementKindOf(node); ok && !p.allows(kind) {
+		return NewPolicyError(nodeExpression(node), fmt.Sprintf("%s statements are not allowed", kind))
+	}
+
+	switch n := node.(type) {
+	case parser.Table:
+		return p.checkTable(ctx, n.Object)
+	case parser.CreateTable:
+		return p.checkTable(ctx, n.Table)
+	case parser.AddColumns:
+		return p.checkTable(ctx, n.Table)
+	case parser.DropColumns:
+		return p.checkTable(ctx, n.Table)
+	case parser.RenameColumn:
+		return p.checkTable(ctx, n.Table)
+	case parser.SetTableAttribute:
+		return p.checkTable(ctx, n.Table)
+	case parser.ShowFields:
+		return p.checkTable(ctx, n.Table)
+	case parser.Function:
+		return p.checkFunction(n, n.Name)
+	case parser.AggregateFunction:
+		return p.checkFunction(n, n.Name)
+	case parser.ListFunction:
+		return p.checkFunction(n, n.Name)
+	case parser.AnalyticFunction:
+		return p.checkFunction(n, n.Name)
+	case parser.StatementPreparation:
+		return p.checkStatementString(ctx, n, n.Statement.Raw(), true)
+	case parser.Execute:
+		if 0 < len(n.Values) {
+			// The statements are formatted with the values at the execution, so they cannot be inspected in advance.
+			return NewPolicyError(n, "EXECUTE with USING is not allowed")
+		}
+		s, ok := constantString(n.Statements)
+		if !ok {
+			return NewPolicyError(n, "EXECUTE with a non-constant statement is not allowed")
+		}
+		return p.checkStatementString(ctx, n, s, false)
+	}
+	return nil
+}
+
+func (p StatementPolicy) allows(kind StatementKind) bool {
+	for _, k := range p.DeniedKinds {
+		if k == kind {
+			return false
+		}
+	}
+	if len(p.AllowedKinds) < 1 {
+		return true
+	}
+	for _, k := range p.AllowedKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (p StatementPolicy) checkTable(ctx context.Context, expr parser.QueryExpression) error {
+	name, ok := tableObjectName(expr)
+	if !ok {
+		return nil
+	}
+	cleaned := filepath.Clean(name)
+	for _, t := range p.DeniedTables {
+		t = filepath.Clean(t)
+		if strings.EqualFold(cleaned, t) || (len(filepath.Ext(t)) < 1 && strings.EqualFold(query.FormatTableName(cleaned), t)) {
+			return NewPolicyError(expr, fmt.Sprintf("table %s is not allowed", t))
+		}
+	}
+
+	// Names that refer to the same files as the denied tables are rejected, such as table aliases and absolute paths.
+	resolve, ok := ctx.Value(tablePathsContextKey{}).(func(string) []string)
+	if !ok {
+		return nil
+	}
+	paths := resolve(name)
+	for _, t := range p.DeniedTables {
+		for _, denied := range resolve(t) {
+			for _, path := range paths {
+				if path == denied {
+					return NewPolicyError(expr, fmt.Sprintf("table %s is not allowed", filepath.Clean(t)))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p StatementPolicy) checkFunction(expr parser.QueryExpression, name string) error {
+	for _, f := range p.DeniedFunctions {
+		if strings.EqualFold(name, f) {
+			return NewPolicyError(expr, fmt.Sprintf("function %s is not allowed", strings.ToUpper(name)))
+		}
+	}
+	return nil
+}
+
+func (p StatementPolicy) checkStatementString(ctx context.Context, expr parser.Expression, s string, forPrepared bool) error {
+	statements, _, err := parser.Parse(s, "", forPrepared, ansiQuotesFromContext(ctx))
+	if err != nil {
+		// Statements that cannot be parsed cannot be inspected, so they are rejected instead of being left to the execution.
+		return NewPolicyError(expr, "statements that cannot be parsed are not allowed")
+	}
+	if err = p.Check(ctx, statements); err != nil {
+		if e, ok := err.(*PolicyError); ok && expr.HasParseInfo() {
+			e.Line = expr.Line()
+			e.Char = expr.Char()
+		}
+	}
+	return err
+}
+
+// nodeExpression returns an expression to get the position of the node.
+// Some statements do not have their positions, so the first expression in the node that has a position is returned.
+func nodeExpression(node interface{}) parser.Expression {
+	var found parser.Expression
+	walkNode(reflect.ValueOf(node), func(n interface{}) bool {
+		if found != nil {
+			return false
+		}
+		if expr, ok := n.(parser.Expression); ok && expr.HasParseInfo() {
+			found = expr
+		}
+		return found == nil
+	})
+	return found
+}
+
+type ansiQuotesContextKey struct{}
+
+// ansiQuotesFromContext returns the AnsiQuotes flag of the connection that checks the statements with its policy.
+func ansiQuotesFromContext(ctx context.Context) bool {
+	b, _ := ctx.Value(ansiQuotesContextKey{}).(bool)
+	return b
+}
+
+type tablePathsContextKey struct{}
+
+// tablePaths returns the paths of the files that the table name refers to in the connection.
+// Table aliases and names qualified by attached schemas are expanded, relative paths are resolved from the repository
+// with the extensions that csvq appends, and the symbolic links are evaluated.
+func (c *Conn) tablePaths(name string) []string {
+	if alias, ok := c.tableAlias(name); ok {
+		name = alias.Path
+	} else if a, table, ok := c.attachedTable(name); ok {
+		name = filepath.Join(a.dir, table)
+	}
+
+	repository, err := repositoryPath(c.proc.Tx.Flags)
+	if err != nil {
+		return nil
+	}
+	candidates := candidatePaths(name, repository)
+	paths := make([]string, 0, len(candidates))
+	for _, p := range candidates {
+		if evaluated, err := evalPath(p); err == nil {
+			paths = append(paths, evaluated)
+		}
+	}
+	return paths
+}
+
+func (c *Conn) hasPolicy() bool {
+	return c.options != nil && c.options.policy != nil
+}
+
+// writtenStatements parses the query string for the policy of the connection.
+// Table names are not rewritten into the paths of the files, so policies inspect the names as written in the query,
+// such as logical table names, names qualified by attached schemas and paths in archives.
+// If the connection has no policy, nil is returned.
+func (c *Conn) writtenStatements(queryString string, forPrepared bool) ([]parser.Statement, error) {
+	if !c.hasPolicy() {
+		return nil, nil
+	}
+
+	queryString = quoteQualifiedNames(queryString, c.proc.Tx.Flags.AnsiQuotes, func(name string) bool {
+		_, ok := c.attachment(name)
+		return ok || isInformationSchema(name)
+	})
+	statements, _, err := parser.Parse(queryString, "", forPrepared, c.proc.Tx.Flags.AnsiQuotes)
+	if err != nil {
+		return nil, query.NewSyntaxError(err.(*parser.SyntaxError))
+	}
+	return statements, nil
+}
+
+// checkStatements checks the statements with the sandbox and the policy of the connection before they are executed.
+// The sandbox checks the statements to be executed, and the policy checks the statements as written,
+// which are returned by writtenStatements.
+func (c *Conn) checkStatements(ctx context.Context, written []parser.Statement, statements []parser.Statement) error {
+	if err := c.checkSandbox(statements); err != nil {
+		return err
+	}
+	if !c.hasPolicy() {
+		return nil
+	}
+	ctx = context.WithValue(ctx, ansiQuotesContextKey{}, c.proc.Tx.Flags.AnsiQuotes)
+	ctx = context.WithValue(ctx, tablePathsContextKey{}, c.tablePaths)
+	return c.options.policy.Check(ctx, written)
+}
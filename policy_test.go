@@ -0,0 +1,254 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mithrandie/csvq/lib/parser"
+)
+
+var statementPolicyTests = []struct {
+	Name   string
+	Policy StatementPolicy
+	Query  string
+	Error  string
+}{
+	{
+		Name:   "Allowed Kind",
+		Policy: StatementPolicy{AllowedKinds: []StatementKind{StatementQuery}},
+		Query:  "VAR @a := 1; SELECT * FROM `table.csv` WHERE col1 = @a",
+	},
+	{
+		Name:   "Not Allowed Kind",
+		Policy: StatementPolicy{AllowedKinds: []StatementKind{StatementQuery}},
+		Query:  "SELECT 1;\nUPDATE `table.csv` SET col2 = 'x'",
+		Error:  "[L:2 C:8] rejected by policy: write statements are not allowed",
+	},
+	{
+		Name:   "Denied Kind",
+		Policy: StatementPolicy{DeniedKinds: []StatementKind{StatementDDL}},
+		Query:  "CREATE TABLE `new.csv` (c1)",
+		Error:  "[L:1 C:14] rejected by policy: DDL statements are not allowed",
+	},
+	{
+		Name:   "Denied Kind in Control Flow",
+		Policy: StatementPolicy{DeniedKinds: []StatementKind{StatementSetFlag}},
+		Query:  "IF TRUE THEN SET @@DATETIME_FORMAT TO '%Y'; END IF;",
+		Error:  "[L:1 C:14] rejected by policy: flag setting statements are not allowed",
+	},
+	{
+		Name:   "External Command",
+		Policy: StatementPolicy{DeniedKinds: []StatementKind{StatementExternalCommand}},
+		Query:  "$echo 1",
+		Error:  "[L:1 C:1] rejected by policy: external command statements are not allowed",
+	},
+	{
+		Name:   "Denied Table",
+		Policy: StatementPolicy{DeniedTables: []string{"secret"}},
+		Query:  "SELECT * FROM `table.csv` t JOIN `Secret.csv` s ON t.col1 = s.col1",
+		Error:  "[L:1 C:34] rejected by policy: table secret is not allowed",
+	},
+	{
+		Name:   "Denied Function",
+		Policy: StatementPolicy{DeniedFunctions: []string{"now"}},
+		Query:  "SELECT col1, NOW() FROM `table.csv`",
+		Error:  "[L:1 C:14] rejected by policy: function NOW is not allowed",
+	},
+	{
+		Name:   "Denied Aggregate Function",
+		Policy: StatementPolicy{DeniedFunctions: []string{"count"}},
+		Query:  "SELECT COUNT(*) FROM `table.csv`",
+		Error:  "[L:1 C:8] rejected by policy: function COUNT is not allowed",
+	},
+	{
+		Name:   "Statements in Execute",
+		Policy: StatementPolicy{DeniedKinds: []StatementKind{StatementWrite}},
+		Query:  "SELECT 1;\nEXECUTE 'DELETE FROM `table.csv`'",
+		Error:  "[L:2 C:1] rejected by policy: write statements are not allowed",
+	},
+	{
+		Name:   "Execute with Using",
+		Policy: StatementPolicy{DeniedTables: []string{"secret"}},
+		Query:  "EXECUTE 'SELECT * FROM %s' USING 'secret'",
+		Error:  "[L:1 C:1] rejected by policy: EXECUTE with USING is not allowed",
+	},
+	{
+		Name:   "Execute with Non-constant Statement",
+		Policy: StatementPolicy{DeniedTables: []string{"secret"}},
+		Query:  "VAR @q := 'SELECT * FROM secret'; EXECUTE @q",
+		Error:  "[L:1 C:35] rejected by policy: EXECUTE with a non-constant statement is not allowed",
+	},
+	{
+		Name:   "Execute with Syntax Error",
+		Policy: StatementPolicy{DeniedTables: []string{"secret"}},
+		Query:  "EXECUTE 'SELECT * FROM'",
+		Error:  "[L:1 C:1] rejected by policy: statements that cannot be parsed are not allowed",
+	},
+	{
+		Name:   "Statements in Prepared Statement",
+		Policy: StatementPolicy{DeniedKinds: []StatementKind{StatementWrite}},
+		Query:  "PREPARE stmt FROM 'DELETE FROM `table.csv` WHERE col1 = ?'",
+		Error:  "[L:1 C:1] rejected by policy: write statements are not allowed",
+	},
+}
+
+func TestStatementPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	for _, v := range statementPolicyTests {
+		db := sql.OpenDB(NewConnector(SchemaTestDir, WithPolicy(v.Policy)))
+
+		rows, err := db.QueryContext(ctx, v.Query)
+		if err == nil {
+			_ = rows.Close()
+		}
+		_ = db.Close()
+
+		if err != nil {
+			if len(v.Error) < 1 {
+				t.Errorf("%s: unexpected error %q", v.Name, err.Error())
+				continue
+			}
+			if err.Error() != v.Error {
+				t.Errorf("%s: error %q, want error %q", v.Name, err.Error(), v.Error)
+			}
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Errorf("%s: error %#v is not a PolicyError", v.Name, err)
+			}
+			continue
+		}
+		if 0 < len(v.Error) {
+			t.Errorf("%s: no error, want error %q", v.Name, v.Error)
+		}
+	}
+}
+
+func TestStatementPolicy_AsWritten(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(SchemaTestDir+"?AnsiQuotes=true",
+		WithTableAlias("secret", TableAlias{Path: "table.csv"}),
+		WithAttachedRepository("ref", SchemaTestDir, true),
+		WithPolicy(StatementPolicy{DeniedTables: []string{"secret", "ref.table"}}),
+	))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	tests := []struct {
+		Query string
+		Args  []interface{}
+		Error string
+	}{
+		{
+			Query: "SELECT * FROM secret",
+			Error: "[L:1 C:15] rejected by policy: table secret is not allowed",
+		},
+		{
+			Query: "SELECT * FROM ref.table WHERE col1 = ?",
+			Args:  []interface{}{1},
+			Error: "[L:1 C:15] rejected by policy: table ref.table is not allowed",
+		},
+		{
+			Query: "EXECUTE 'SELECT * FROM \"secret\"'",
+			Error: "[L:1 C:1] rejected by policy: table secret is not allowed",
+		},
+	}
+	for _, v := range tests {
+		_, err := db.ExecContext(ctx, v.Query, v.Args...)
+		if err == nil {
+			t.Errorf("%s: no error, want error %q", v.Query, v.Error)
+			continue
+		}
+		if err.Error() != v.Error {
+			t.Errorf("%s: error %q, want error %q", v.Query, err.Error(), v.Error)
+		}
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	var checked [][]parser.Statement
+	policy := PolicyFunc(func(ctx context.Context, statements []parser.Statement) error {
+		checked = append(checked, statements)
+		if _, ok := statements[0].(parser.SelectQuery); !ok {
+			return NewPolicyError(statements[0].(parser.Expression), "only a select query is allowed")
+		}
+		return nil
+	})
+
+	db := sql.OpenDB(NewConnector(SchemaTestDir, WithPolicy(policy)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var col2 string
+	if err := db.QueryRowContext(ctx, "SELECT col2 FROM `table.csv` WHERE col1 = ?", 1).Scan(&col2); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if col2 != "str1" {
+		t.Errorf("col2 = %q, want %q", col2, "str1")
+	}
+
+	expect := "[L:1 C:1] rejected by policy: only a select query is allowed"
+	if _, err := db.ExecContext(ctx, "DELETE FROM `table.csv`"); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+	if len(checked) != 2 {
+		t.Errorf("policy is called %d times, want %d times", len(checked), 2)
+	}
+}
+
+func TestStatementPolicy_ResolvedTables(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(SchemaTestDir,
+		WithTableAlias("s", TableAlias{Path: "table.csv"}),
+		WithAttachedRepository("ref", SchemaTestDir, true),
+		WithPolicy(StatementPolicy{DeniedTables: []string{"table.csv"}}),
+	))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	tests := []struct {
+		Name  string
+		Query string
+	}{
+		{
+			Name:  "Without Extension",
+			Query: "SELECT * FROM `table`",
+		},
+		{
+			Name:  "Absolute Path",
+			Query: "SELECT * FROM `" + filepath.Join(SchemaTestDir, "table.csv") + "`",
+		},
+		{
+			Name:  "Table Alias",
+			Query: "SELECT * FROM s",
+		},
+		{
+			Name:  "Attached Schema",
+			Query: "SELECT * FROM ref.`table`",
+		},
+	}
+	for _, v := range tests {
+		expect := "[L:1 C:15] rejected by policy: table table.csv is not allowed"
+		if _, err := db.ExecContext(ctx, v.Query); err == nil || err.Error() != expect {
+			t.Errorf("%s: error %v, want error %q", v.Name, err, expect)
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "SELECT * FROM types"); err != nil {
+		t.Errorf("unexpected error %q", err.Error())
+	}
+}
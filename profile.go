@@ -0,0 +1,102 @@
+package csvq
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// profile holds the statements executed on every new connection and every time the session is reset,
+// and the flags of the connection before the statements are executed.
+type profile struct {
+	statements []parser.Statement
+	// written holds the statements as written in the profile, which the policy of the connection checks.
+	written []parser.Statement
+	flags   option.Flags
+}
+
+func copyFlags(flags *option.Flags) option.Flags {
+	f := *flags
+	f.DatetimeFormat = append([]string(nil), flags.DatetimeFormat...)
+	f.ImportOptions = flags.ImportOptions.Copy()
+	f.ExportOptions = flags.ExportOptions.Copy()
+	return f
+}
+
+// applyProfile executes the statements of the profile passed by WithProfile.
+// The profile is rewritten and checked with the sandbox and the policy of the connection in the same way as other statements.
+func (c *Conn) applyProfile(ctx context.Context) error {
+	if len(c.options.profile) < 1 {
+		return nil
+	}
+
+	if c.profile == nil {
+		p, err := c.parseProfile(c.options.profile)
+		if err != nil {
+			return fmt.Errorf("invalid profile: %w", err)
+		}
+		c.profile = p
+	}
+
+	if err := c.checkStatements(ctx, c.profile.written, c.profile.statements); err != nil {
+		return fmt.Errorf("failed to apply the profile: %w", err)
+	}
+	dispose, err := c.declareVirtualTables(ctx, c.profile.statements)
+	if err != nil {
+		return fmt.Errorf("failed to apply the profile: %w", err)
+	}
+	defer dispose()
+
+	if _, err := executeStatements(ctx, c, c.proc, c.profile.statements); err != nil {
+		return fmt.Errorf("failed to apply the profile: %w", err)
+	}
+	return nil
+}
+
+func (c *Conn) parseProfile(profileString string) (*profile, error) {
+	written, err := c.writtenStatements(profileString, false)
+	if err != nil {
+		return nil, err
+	}
+	rewritten, err := c.rewriteQuery(profileString)
+	if err != nil {
+		return nil, err
+	}
+	statements, _, err := parser.Parse(rewritten, "", false, c.proc.Tx.Flags.AnsiQuotes)
+	if err != nil {
+		return nil, query.NewSyntaxError(err.(*parser.SyntaxError))
+	}
+	return &profile{
+		statements: statements,
+		written:    written,
+		flags:      copyFlags(c.proc.Tx.Flags),
+	}, nil
+}
+
+// resetProfile discards the variables, functions, temporary tables, cursors, prepared statements and flags
+// of the connection, and applies the profile again.
+// Prepared statements that the driver prepares are not discarded because they can still be used.
+func (c *Conn) resetProfile(ctx context.Context) error {
+	if c.profile == nil {
+		return nil
+	}
+
+	c.proc.ReferenceScope.ClearCurrentBlock()
+	for _, name := range c.proc.Tx.PreparedStatements.Keys() {
+		if !strings.HasPrefix(strings.ToLower(name), statementPrefix) {
+			c.proc.Tx.PreparedStatements.Delete(name)
+		}
+	}
+	*c.proc.Tx.Flags = copyFlags(&c.profile.flags)
+
+	if err := c.applyProfile(ctx); err != nil {
+		// The connection is discarded because its session is not consistent with the other connections.
+		return driver.ErrBadConn
+	}
+	return nil
+}
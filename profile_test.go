@@ -0,0 +1,138 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+const testProfile = `
+VAR @greeting := 'hello';
+DECLARE double FUNCTION (@x) AS BEGIN RETURN @x * 2; END;
+DECLARE numbers VIEW (n);
+INSERT INTO numbers VALUES (1), (2);
+SET @@STRICT_EQUAL TO TRUE;
+`
+
+func TestWithProfile(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TestDir, WithProfile(testProfile)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conns := make([]*sql.Conn, 0, 2)
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		conns = append(conns, conn)
+	}
+
+	checkProfile := func(conn *sql.Conn) {
+		var greeting string
+		var doubled, count int
+		var strictEqual bool
+		row := conn.QueryRowContext(ctx, "SELECT @greeting, double(2), (SELECT COUNT(*) FROM numbers), @@STRICT_EQUAL")
+		if err := row.Scan(&greeting, &doubled, &count, &strictEqual); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		if greeting != "hello" || doubled != 4 || count != 2 || !strictEqual {
+			t.Errorf("result = (%q, %d, %d, %t), want (%q, %d, %d, %t)", greeting, doubled, count, strictEqual, "hello", 4, 2, true)
+		}
+	}
+	for _, conn := range conns {
+		checkProfile(conn)
+	}
+
+	conn := conns[0]
+	_, err := conn.ExecContext(ctx, "@greeting := 'changed'; VAR @extra := 1; DELETE FROM numbers; SET @@STRICT_EQUAL TO FALSE; PREPARE stmt FROM 'SELECT 1';")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	stmt, err := conn.PrepareContext(ctx, "SELECT @greeting WHERE 1 = ?")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		return driverConn.(driver.SessionResetter).ResetSession(ctx)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	checkProfile(conn)
+	if _, err = conn.ExecContext(ctx, "SELECT @extra"); err == nil {
+		t.Error("variable declared in the session is not discarded")
+	}
+	if _, err = conn.ExecContext(ctx, "PREPARE stmt FROM 'SELECT 2'"); err != nil {
+		t.Errorf("prepared statement is not discarded: %s", err.Error())
+	}
+	var greeting string
+	if err = stmt.QueryRowContext(ctx, 1).Scan(&greeting); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if greeting != "hello" {
+		t.Errorf("greeting = %q, want %q", greeting, "hello")
+	}
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
+
+func TestWithProfile_Error(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TestDir, WithProfile("VAR @a := 1; SELECT @undeclared;")))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := "failed to apply the profile: [L:1 C:21] variable @undeclared is undeclared"
+	if err := db.PingContext(ctx); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+}
+
+func TestWithProfile_Rewrite(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	profile := "DECLARE users VIEW AS SELECT * FROM members; DECLARE refs VIEW AS SELECT * FROM ref.`table.csv`;"
+	db := sql.OpenDB(NewConnector(TestDir,
+		WithTableAlias("members", TableAlias{Path: "table_q.csv"}),
+		WithAttachedRepository("ref", SchemaTestDir, true),
+		WithProfile(profile),
+	))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM users) + (SELECT COUNT(*) FROM refs)").Scan(&count); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if count != 6 {
+		t.Errorf("count = %d, want %d", count, 6)
+	}
+
+	db2 := sql.OpenDB(NewConnector(TestDir+"?Sandbox=true", WithProfile("SELECT * FROM `/etc/passwd`;")))
+	defer func() {
+		_ = db2.Close()
+	}()
+
+	expect := "failed to apply the profile: [L:1 C:15] permission denied: access to \"/etc/passwd\" is not allowed"
+	if err := db2.PingContext(ctx); err == nil || err.Error() != expect {
+		t.Errorf("error %v, want error %q", err, expect)
+	}
+}
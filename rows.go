@@ -1,10 +1,13 @@
 package csvq
 
 import (
+	"context"
 	"database/sql/driver"
 	"errors"
 	"io"
+	"strings"
 
+	"github.com/mithrandie/csvq/lib/option"
 	"github.com/mithrandie/csvq/lib/query"
 	"github.com/mithrandie/csvq/lib/value"
 	"github.com/mithrandie/ternary"
@@ -13,6 +16,9 @@ import (
 type resultSet struct {
 	view     *query.View
 	rowIndex int
+
+	schemas []*ColumnSchema
+	flags   *option.Flags
 }
 
 func newResultSet(view *query.View) *resultSet {
@@ -22,6 +28,20 @@ func newResultSet(view *query.View) *resultSet {
 	}
 }
 
+// setSchemas sets the declared schemas to the columns that are selected from the tables as they are.
+func (r *resultSet) setSchemas(schemas map[string]*TableSchema, flags *option.Flags) {
+	r.schemas = make([]*ColumnSchema, len(r.view.Header))
+	r.flags = flags
+	for i, field := range r.view.Header {
+		if !field.IsFromTable || len(field.View) < 1 {
+			continue
+		}
+		if schema, ok := schemas[strings.ToUpper(field.View)]; ok {
+			r.schemas[i] = schema.column(field.Column)
+		}
+	}
+}
+
 func (r *resultSet) columns() []string {
 	return r.view.Header.TableColumnNames()
 }
@@ -37,35 +57,48 @@ func (r *resultSet) next(dest []driver.Value) error {
 
 	for i, v := range r.view.RecordSet[r.rowIndex] {
 		val := v[0]
-		switch val.(type) {
-		case *value.String:
-			dest[i] = val.(*value.String).Raw()
-		case *value.Integer:
-			dest[i] = val.(*value.Integer).Raw()
-		case *value.Float:
-			dest[i] = val.(*value.Float).Raw()
-		case *value.Boolean:
-			dest[i] = val.(*value.Boolean).Raw()
-		case *value.Ternary:
-			if val.Ternary() == ternary.UNKNOWN {
-				dest[i] = nil
-			} else {
-				dest[i] = val.Ternary().ParseBool()
+		if r.schemas != nil && r.schemas[i] != nil {
+			converted, err := r.schemas[i].convert(val, r.flags)
+			if err != nil {
+				return NewSchemaError(r.view.Header[i].View, r.view.Header[i].Column, r.rowIndex+1, val.String(), err)
 			}
-		case *value.Datetime:
-			dest[i] = val.(*value.Datetime).Raw()
-		default: // Null
-			dest[i] = nil
+			val = converted
 		}
+		dest[i] = driverValue(val)
 	}
 
 	r.rowIndex++
 	return nil
 }
 
+// driverValue converts the value of csvq into the value returned by the driver.
+func driverValue(val value.Primary) driver.Value {
+	switch val.(type) {
+	case *value.String:
+		return val.(*value.String).Raw()
+	case *value.Integer:
+		return val.(*value.Integer).Raw()
+	case *value.Float:
+		return val.(*value.Float).Raw()
+	case *value.Boolean:
+		return val.(*value.Boolean).Raw()
+	case *value.Ternary:
+		if val.Ternary() == ternary.UNKNOWN {
+			return nil
+		}
+		return val.Ternary().ParseBool()
+	case *value.Datetime:
+		return val.(*value.Datetime).Raw()
+	default: // Null
+		return nil
+	}
+}
+
 type Rows struct {
 	resultSets []*resultSet
 	index      int
+	span       Span
+	count      int
 }
 
 func NewRows(selectedViews []*query.View) *Rows {
@@ -77,9 +110,16 @@ func NewRows(selectedViews []*query.View) *Rows {
 	return &Rows{
 		resultSets: sets,
 		index:      0,
+		span:       noopSpan{},
 	}
 }
 
+func newTracedRows(ctx context.Context, options *connectorOptions, selectedViews []*query.View) *Rows {
+	rows := NewRows(selectedViews)
+	_, rows.span = startSpan(ctx, options, OperationRows)
+	return rows
+}
+
 func (r *Rows) Columns() []string {
 	if len(r.resultSets) <= r.index {
 		return nil
@@ -89,6 +129,10 @@ func (r *Rows) Columns() []string {
 }
 
 func (r *Rows) Close() error {
+	if r.resultSets != nil && r.span != nil {
+		r.span.SetAttributes(Attribute{Key: AttributeRowsReturned, Value: r.count})
+		r.span.End(nil)
+	}
 	r.resultSets = nil
 	r.index = 0
 	return nil
@@ -98,7 +142,11 @@ func (r *Rows) Next(dest []driver.Value) error {
 	if len(r.resultSets) <= r.index {
 		return io.EOF
 	}
-	return r.resultSets[r.index].next(dest)
+	if err := r.resultSets[r.index].next(dest); err != nil {
+		return err
+	}
+	r.count++
+	return nil
 }
 
 func (r *Rows) HasNextResultSet() bool {
@@ -0,0 +1,341 @@
+package csvq
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+	"github.com/mithrandie/csvq/lib/value"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+// PermissionError is returned when a statement accesses a file outside the directories that the connection is confined to,
+// or uses a feature that cannot be confined.
+// Line and Char are the position of the expression in the statement, or zero if the position is unknown.
+type PermissionError struct {
+	Path    string
+	Line    int
+	Char    int
+	Message string
+}
+
+func NewPermissionError(expr parser.Expression, path string, message string) error {
+	e := &PermissionError{
+		Path:    path,
+		Message: message,
+	}
+	if expr != nil && expr.HasParseInfo() {
+		e.Line = expr.Line()
+		e.Char = expr.Char()
+	}
+	return e
+}
+
+func (e PermissionError) Error() string {
+	if 0 < e.Line {
+		return fmt.Sprintf("[L:%d C:%d] %s: %s", e.Line, e.Char, ErrPermissionDenied.Error(), e.Message)
+	}
+	return fmt.Sprintf("%s: %s", ErrPermissionDenied.Error(), e.Message)
+}
+
+func (e PermissionError) Unwrap() error {
+	return ErrPermissionDenied
+}
+
+// sandbox confines the file access of a connection to the directories.
+type sandbox struct {
+	dirs []string
+}
+
+func newSandbox(dirs []string) (*sandbox, error) {
+	s := &sandbox{dirs: make([]string, 0, len(dirs))}
+	for _, dir := range dirs {
+		p, err := evalPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sandbox directory %q: %w", dir, err)
+		}
+		s.dirs = append(s.dirs, p)
+	}
+	return s, nil
+}
+
+// evalPath returns the absolute path with the symbolic links evaluated.
+// If the file does not exist, the symbolic links in the nearest existing directory are evaluated.
+func evalPath(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+
+	rest := make([]string, 0, 2)
+	for {
+		evaluated, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{evaluated}, rest...)...), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p, nil
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
+
+func isInDirectory(p string, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s *sandbox) allows(p string) bool {
+	for _, dir := range s.dirs {
+		if isInDirectory(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPath returns a PermissionError if the file is outside the directories of the sandbox.
+// Relative paths are resolved from the repository as csvq does.
+func (c *Conn) checkPath(expr parser.Expression, name string) error {
+	if c.sandbox == nil {
+		return nil
+	}
+
+	repository, err := repositoryPath(c.proc.Tx.Flags)
+	if err != nil {
+		return err
+	}
+	for _, p := range candidatePaths(name, repository) {
+		if p, err = evalPath(p); err != nil {
+			return err
+		}
+		if !c.sandboxAllows(p) {
+			return NewPermissionError(expr, name, fmt.Sprintf("access to %q is not allowed", name))
+		}
+	}
+	return nil
+}
+
+func (c *Conn) sandboxAllows(p string) bool {
+	if c.sandbox.allows(p) {
+		return true
+	}
+	if c.archives != nil && 0 < len(c.archives.dir) {
+		if dir, err := evalPath(c.archives.dir); err == nil && isInDirectory(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidatePaths returns the paths of the files that csvq can open for the name.
+// csvq appends the extensions of the table files to names of files that do not exist,
+// so the files resolved with the extensions are returned in addition to the path of the name.
+func candidatePaths(name string, repository string) []string {
+	p := name
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(repository, p)
+	}
+	paths := []string{p}
+
+	resolved, err := query.SearchFilePathFromAllTypes(parser.Identifier{Literal: p}, repository)
+	if err == nil {
+		if resolved != p {
+			paths = append(paths, resolved)
+		}
+		return paths
+	}
+	// If the name is ambiguous, the file is selected by the format of the table, so every file is a candidate.
+	for _, ext := range []string{option.CsvExt, option.TsvExt, option.JsonExt, option.JsonlExt, option.LtsvExt, option.TextExt} {
+		if _, err := os.Stat(p + ext); err == nil {
+			paths = append(paths, p+ext)
+		}
+	}
+	return paths
+}
+
+// checkSandbox returns a PermissionError if the statements access files outside the directories of the sandbox.
+// Statements whose file access cannot be determined before the execution are also rejected,
+// such as SOURCE and EXECUTE with non-constant values, EXECUTE with USING, and statement strings that cannot be parsed.
+func (c *Conn) checkSandbox(statements []parser.Statement) error {
+	if c.sandbox == nil {
+		return nil
+	}
+	check := &sandboxCheck{
+		conn:    c,
+		sources: make(map[string]bool),
+	}
+	return check.statements(statements)
+}
+
+type sandboxCheck struct {
+	conn *Conn
+	// sources holds the files that are read by SOURCE statements and already checked.
+	sources map[string]bool
+}
+
+func (s *sandboxCheck) statements(statements []parser.Statement) error {
+	var err error
+	walkStatements(statements, func(node interface{}) bool {
+		if err == nil {
+			err = s.node(node)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func (s *sandboxCheck) node(node interface{}) error {
+	switch n := node.(type) {
+	case parser.Table:
+		return s.tableObject(n.Object)
+	case parser.CreateTable:
+		return s.tableObject(n.Table)
+	case parser.AddColumns:
+		return s.tableObject(n.Table)
+	case parser.DropColumns:
+		return s.tableObject(n.Table)
+	case parser.RenameColumn:
+		return s.tableObject(n.Table)
+	case parser.SetTableAttribute:
+		return s.tableObject(n.Table)
+	case parser.ShowFields:
+		return s.tableObject(n.Table)
+	case parser.Source:
+		return s.source(n)
+	case parser.StatementPreparation:
+		return s.statementString(n, n.Statement.Raw(), true)
+	case parser.Execute:
+		if 0 < len(n.Values) {
+			// The statements are formatted with the values at the execution, so they cannot be checked in advance.
+			return NewPermissionError(n, "", "EXECUTE with USING is not allowed")
+		}
+		str, ok := constantString(n.Statements)
+		if !ok {
+			return NewPermissionError(n, "", "EXECUTE with a non-constant statement is not allowed")
+		}
+		return s.statementString(n, str, false)
+	case parser.SetFlag:
+		if strings.EqualFold(n.Flag.Name, option.RepositoryFlag) {
+			return NewPermissionError(n.Flag, "", "changing the repository is not allowed")
+		}
+	case parser.Chdir:
+		return NewPermissionError(n, "", "changing the working directory is not allowed")
+	case parser.Reload:
+		return NewPermissionError(n.Type, "", "reloading the configuration is not allowed")
+	case parser.ExternalCommand:
+		return NewPermissionError(n, "", "external commands are not allowed")
+	}
+	return nil
+}
+
+func (s *sandboxCheck) tableObject(expr parser.QueryExpression) error {
+	switch e := expr.(type) {
+	case parser.Identifier:
+		if strings.HasPrefix(e.Literal, "http://") || strings.HasPrefix(e.Literal, "https://") {
+			return nil
+		}
+		return s.conn.checkPath(e, e.Literal)
+	case parser.Url:
+		obj, err := query.ConvertUrlExpr(e)
+		if err != nil {
+			return err
+		}
+		if id, ok := obj.(parser.Identifier); ok {
+			return s.conn.checkPath(e, id.Literal)
+		}
+	case parser.TableFunction:
+		switch strings.ToUpper(e.Name) {
+		case "FILE", "INLINE", "URL":
+			if len(e.Args) != 1 {
+				return nil
+			}
+			str, ok := constantString(e.Args[0])
+			if !ok {
+				return NewPermissionError(e, "", fmt.Sprintf("%s with a non-constant path is not allowed", strings.ToUpper(e.Name)))
+			}
+			if strings.EqualFold(e.Name, "URL") {
+				return s.tableObject(parser.Url{BaseExpr: e.BaseExpr, Raw: str})
+			}
+			return s.conn.checkPath(e, str)
+		}
+	case parser.FormatSpecifiedFunction:
+		return s.tableObject(e.Path)
+	}
+	return nil
+}
+
+// source checks the file read by the SOURCE statement and the statements in the file.
+func (s *sandboxCheck) source(source parser.Source) error {
+	var name string
+	if id, ok := source.FilePath.(parser.Identifier); ok {
+		name = id.Literal
+	} else if str, ok := constantString(source.FilePath); ok {
+		name = str
+	} else {
+		return NewPermissionError(source, "", "SOURCE with a non-constant path is not allowed")
+	}
+
+	if err := s.conn.checkPath(source, name); err != nil {
+		return err
+	}
+
+	p := name
+	if !filepath.IsAbs(p) {
+		repository, err := repositoryPath(s.conn.proc.Tx.Flags)
+		if err != nil {
+			return err
+		}
+		p = filepath.Join(repository, p)
+	}
+	if s.sources[p] {
+		return nil
+	}
+	s.sources[p] = true
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return NewPermissionError(source, name, fmt.Sprintf("%q cannot be read to check the statements", name))
+	}
+	return s.statementString(source, string(b), false)
+}
+
+// statementString parses the statements in the string and checks them.
+// The position of a returned error is the position of the expression.
+func (s *sandboxCheck) statementString(expr parser.Expression, str string, forPrepared bool) error {
+	statements, _, err := parser.Parse(str, "", forPrepared, s.conn.proc.Tx.Flags.AnsiQuotes)
+	if err != nil {
+		// Statements that cannot be parsed cannot be checked, so they are rejected instead of being left to the execution.
+		return NewPermissionError(expr, "", "statements that cannot be parsed are not allowed")
+	}
+	if err = s.statements(statements); err != nil {
+		if e, ok := err.(*PermissionError); ok && expr.HasParseInfo() {
+			e.Line = expr.Line()
+			e.Char = expr.Char()
+		}
+	}
+	return err
+}
+
+func constantString(expr parser.QueryExpression) (string, bool) {
+	p, ok := expr.(parser.PrimitiveType)
+	if !ok {
+		return "", false
+	}
+	s, ok := p.Value.(*value.String)
+	if !ok {
+		return "", false
+	}
+	return s.Raw(), true
+}
@@ -0,0 +1,205 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupSandboxDirs(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	repository := filepath.Join(dir, "repository")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{repository, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := copyfile(filepath.Join(d, "table.csv"), filepath.Join(TestDataDir, "table.csv")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repository, "source.sql"), []byte("SELECT * FROM `../outside/table.csv`;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return repository, outside
+}
+
+func TestSandbox(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	repository, outside := setupSandboxDirs(t)
+	if err := os.Symlink(outside, filepath.Join(repository, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "table.csv"), filepath.Join(repository, "linked.csv")); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("csvq", repository+"?sandbox=true")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := [][]interface{}{
+		{1, "str1"},
+		{2, "str2"},
+		{3, "str3"},
+	}
+	if err := matchRows(ctx, db, expect, "SELECT * FROM `table.csv`"); err != nil {
+		t.Fatal(err)
+	}
+	if err := matchRows(ctx, db, expect, "SELECT * FROM FILE::('table.csv')"); err != nil {
+		t.Fatal(err)
+	}
+
+	absPath := filepath.Join(outside, "table.csv")
+	tests := []struct {
+		Name  string
+		Query string
+		Error string
+	}{
+		{
+			Name:  "Relative Path",
+			Query: "SELECT * FROM `../outside/table.csv`",
+			Error: "[L:1 C:15] permission denied: access to \"../outside/table.csv\" is not allowed",
+		},
+		{
+			Name:  "Absolute Path",
+			Query: "SELECT * FROM `" + absPath + "`",
+			Error: "[L:1 C:15] permission denied: access to \"" + absPath + "\" is not allowed",
+		},
+		{
+			Name:  "Symbolic Link",
+			Query: "SELECT * FROM `link/table.csv`",
+			Error: "[L:1 C:15] permission denied: access to \"link/table.csv\" is not allowed",
+		},
+		{
+			Name:  "Symbolic Link Resolved with Extension",
+			Query: "SELECT * FROM linked",
+			Error: "[L:1 C:15] permission denied: access to \"linked\" is not allowed",
+		},
+		{
+			Name:  "Format Specified Function",
+			Query: "SELECT * FROM CSV(',', `../outside/table.csv`)",
+			Error: "[L:1 C:24] permission denied: access to \"../outside/table.csv\" is not allowed",
+		},
+		{
+			Name:  "Table Function with Non-constant Path",
+			Query: "VAR @p := 'table.csv'; SELECT * FROM FILE::(@p)",
+			Error: "[L:1 C:38] permission denied: FILE with a non-constant path is not allowed",
+		},
+		{
+			Name:  "Url",
+			Query: "SELECT * FROM file:///etc/passwd",
+			Error: "[L:1 C:15] permission denied: access to \"/etc/passwd\" is not allowed",
+		},
+		{
+			Name:  "Create Table",
+			Query: "CREATE TABLE `../outside/new.csv` (c1)",
+			Error: "[L:1 C:14] permission denied: access to \"../outside/new.csv\" is not allowed",
+		},
+		{
+			Name:  "Source",
+			Query: "SOURCE `source.sql`",
+			Error: "[L:1 C:1] permission denied: access to \"../outside/table.csv\" is not allowed",
+		},
+		{
+			Name:  "Execute",
+			Query: "EXECUTE 'SELECT * FROM `../outside/table.csv`'",
+			Error: "[L:1 C:1] permission denied: access to \"../outside/table.csv\" is not allowed",
+		},
+		{
+			Name:  "Execute with Using",
+			Query: "EXECUTE 'SELECT * FROM `%s`' USING '../outside/table.csv'",
+			Error: "[L:1 C:1] permission denied: EXECUTE with USING is not allowed",
+		},
+		{
+			Name:  "Execute with Syntax Error",
+			Query: "EXECUTE 'SELECT * FROM'",
+			Error: "[L:1 C:1] permission denied: statements that cannot be parsed are not allowed",
+		},
+		{
+			Name:  "Set Repository",
+			Query: "SET @@REPOSITORY TO '/'",
+			Error: "[L:1 C:5] permission denied: changing the repository is not allowed",
+		},
+		{
+			Name:  "Chdir",
+			Query: "CHDIR '/'",
+			Error: "[L:1 C:1] permission denied: changing the working directory is not allowed",
+		},
+		{
+			Name:  "External Command",
+			Query: "$ls /",
+			Error: "[L:1 C:1] permission denied: external commands are not allowed",
+		},
+		{
+			Name:  "In User Defined Function",
+			Query: "DECLARE f FUNCTION () AS BEGIN RETURN (SELECT COUNT(*) FROM `../outside/table.csv`); END;",
+			Error: "[L:1 C:61] permission denied: access to \"../outside/table.csv\" is not allowed",
+		},
+	}
+
+	for _, v := range tests {
+		_, err := db.ExecContext(ctx, v.Query)
+		if err == nil {
+			t.Errorf("%s: no error, want error %q", v.Name, v.Error)
+			continue
+		}
+		if err.Error() != v.Error {
+			t.Errorf("%s: error %q, want error %q", v.Name, err.Error(), v.Error)
+		}
+		var permErr *PermissionError
+		if !errors.As(err, &permErr) || !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s: error %#v is not a PermissionError", v.Name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "new.csv")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("file outside the sandbox is created")
+	}
+
+	if _, err := db.PrepareContext(ctx, "SELECT * FROM `../outside/table.csv` WHERE col1 = ?"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error %v, want a PermissionError for the prepared statement", err)
+	}
+}
+
+func TestWithSandbox(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	repository, outside := setupSandboxDirs(t)
+
+	db := sql.OpenDB(NewConnector(repository, WithSandbox(outside)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := [][]interface{}{
+		{1, "str1"},
+		{2, "str2"},
+		{3, "str3"},
+	}
+	if err := matchRows(ctx, db, expect, "SELECT * FROM `../outside/table.csv`"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err = DescribeTable(ctx, conn, "/etc/passwd"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error %v, want a PermissionError", err)
+	}
+}
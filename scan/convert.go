@@ -0,0 +1,187 @@
+package scan
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/value"
+	"github.com/mithrandie/ternary"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	ternaryType = reflect.TypeOf(ternary.UNKNOWN)
+)
+
+// isValueType reports whether the struct type is assigned as a single value instead of being mapped field by field.
+func isValueType(t reflect.Type) bool {
+	return t == timeType || reflect.PtrTo(t).Implements(scannerType)
+}
+
+// assign converts the value returned by the driver to the type of the field and sets it to the field.
+func assign(field reflect.Value, src interface{}) error {
+	if field.CanAddr() && field.Addr().Type().Implements(scannerType) {
+		return field.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+
+	if field.Kind() == reflect.Ptr {
+		if src == nil {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		v := reflect.New(field.Type().Elem())
+		if err := assign(v.Elem(), src); err != nil {
+			return err
+		}
+		field.Set(v)
+		return nil
+	}
+
+	if field.Type() == ternaryType {
+		t, err := toTernary(src)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if src == nil {
+		if field.Kind() == reflect.Interface {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot assign NULL to %s, use a pointer or a sql.Scanner", field.Type())
+	}
+
+	if field.Type() == timeType {
+		t, err := toTime(src)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Interface:
+		field.Set(reflect.ValueOf(src))
+	case reflect.String:
+		field.SetString(toString(src))
+	case reflect.Bool:
+		t, err := toTernary(src)
+		if err != nil || t == ternary.UNKNOWN {
+			return conversionError(src, field.Type())
+		}
+		field.SetBool(t.ParseBool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt64(src)
+		if err != nil || field.OverflowInt(i) {
+			return conversionError(src, field.Type())
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := toInt64(src)
+		if err != nil || i < 0 || field.OverflowUint(uint64(i)) {
+			return conversionError(src, field.Type())
+		}
+		field.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat64(src)
+		if err != nil || field.OverflowFloat(f) {
+			return conversionError(src, field.Type())
+		}
+		field.SetFloat(f)
+	default:
+		v := reflect.ValueOf(src)
+		if !v.Type().ConvertibleTo(field.Type()) {
+			return conversionError(src, field.Type())
+		}
+		field.Set(v.Convert(field.Type()))
+	}
+	return nil
+}
+
+func conversionError(src interface{}, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %v (%T) to %s", src, src, t)
+}
+
+func toString(src interface{}) string {
+	switch v := src.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(src)
+}
+
+func toInt64(src interface{}) (int64, error) {
+	switch v := src.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, conversionError(src, reflect.TypeOf(int64(0)))
+		}
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	}
+	return 0, conversionError(src, reflect.TypeOf(int64(0)))
+}
+
+func toFloat64(src interface{}) (float64, error) {
+	switch v := src.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, conversionError(src, reflect.TypeOf(float64(0)))
+}
+
+// toTernary converts a value in the same way as csvq converts values to ternary values.
+func toTernary(src interface{}) (ternary.Value, error) {
+	switch v := src.(type) {
+	case nil:
+		return ternary.UNKNOWN, nil
+	case bool:
+		return ternary.ConvertFromBool(v), nil
+	case int64:
+		return value.NewInteger(v).Ternary(), nil
+	case float64:
+		return value.NewFloat(v).Ternary(), nil
+	case string:
+		return value.NewString(v).Ternary(), nil
+	}
+	return ternary.UNKNOWN, conversionError(src, ternaryType)
+}
+
+// toTime converts a value in the same way as csvq converts values to datetime values in the local time zone.
+func toTime(src interface{}) (time.Time, error) {
+	switch v := src.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		if t, ok := value.StrToTime(v, nil, time.Local); ok {
+			return t, nil
+		}
+	}
+	return time.Time{}, conversionError(src, timeType)
+}
@@ -0,0 +1,277 @@
+// Package scan maps the columns of *sql.Rows returned by the csvq driver to struct fields.
+//
+// A column is mapped to a field that has the same name in the "csvq" tag, or whose name matches the column name
+// case-insensitively, ignoring underscores. Fields tagged with "-" and unexported fields are ignored.
+// Fields of embedded structs are mapped as if they were fields of the outer struct.
+// Columns that no fields are mapped to are ignored.
+package scan
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const TagName = "csvq"
+
+var errDestination = errors.New("destination must be a non-nil pointer")
+
+// ScanOne scans the first row into dest, which must be a pointer to a struct, and closes the rows.
+// If there are no rows, sql.ErrNoRows is returned.
+func ScanOne(rows *sql.Rows, dest interface{}) error {
+	it := NewIterator(rows)
+	defer func() {
+		_ = it.Close()
+	}()
+
+	if !it.Next() {
+		if err := it.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := it.Scan(dest); err != nil {
+		return err
+	}
+	return it.Close()
+}
+
+// ScanAll scans all rows into dest, which must be a pointer to a slice of structs or pointers to structs,
+// and closes the rows.
+func ScanAll(rows *sql.Rows, dest interface{}) error {
+	it := NewIterator(rows)
+	defer func() {
+		_ = it.Close()
+	}()
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w to a slice, got %T", errDestination, dest)
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("%w to a slice of structs, got %T", errDestination, dest)
+	}
+
+	for it.Next() {
+		elem := reflect.New(elemType)
+		if err := it.Scan(elem.Interface()); err != nil {
+			return err
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, elem))
+		} else {
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return it.Close()
+}
+
+// Iterator scans rows into structs one by one.
+type Iterator struct {
+	rows    *sql.Rows
+	columns []string
+	values  []interface{}
+	ptrs    []interface{}
+	err     error
+
+	mappings map[reflect.Type][][]int
+}
+
+func NewIterator(rows *sql.Rows) *Iterator {
+	return &Iterator{
+		rows:     rows,
+		mappings: make(map[reflect.Type][][]int),
+	}
+}
+
+// Next prepares the next row. It returns false when there are no more rows or an error occurred.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	return it.rows.Next()
+}
+
+// Scan scans the current row into dest, which must be a pointer to a struct.
+func (it *Iterator) Scan(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w to a struct, got %T", errDestination, dest)
+	}
+
+	if it.columns == nil {
+		columns, err := it.rows.Columns()
+		if err != nil {
+			it.err = err
+			return err
+		}
+		it.columns = columns
+		it.values = make([]interface{}, len(columns))
+		it.ptrs = make([]interface{}, len(columns))
+		for i := range it.values {
+			it.ptrs[i] = &it.values[i]
+		}
+	}
+
+	if err := it.rows.Scan(it.ptrs...); err != nil {
+		it.err = err
+		return err
+	}
+
+	mapping := it.mapping(v.Elem().Type())
+	for i, index := range mapping {
+		if index == nil {
+			continue
+		}
+		field := fieldByIndex(v.Elem(), index)
+		if err := assign(field, it.values[i]); err != nil {
+			return fmt.Errorf("scan: column %s: %w", it.columns[i], err)
+		}
+	}
+	return nil
+}
+
+// Err returns the error occurred during the iteration.
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+func (it *Iterator) Close() error {
+	return it.rows.Close()
+}
+
+func (it *Iterator) mapping(t reflect.Type) [][]int {
+	if m, ok := it.mappings[t]; ok {
+		return m
+	}
+
+	fields := structFields(t)
+	m := make([][]int, len(it.columns))
+	for i, column := range it.columns {
+		m[i] = fields.lookup(column)
+	}
+	it.mappings[t] = m
+	return m
+}
+
+type fieldMap struct {
+	tagged map[string][]int
+	named  map[string][]int
+}
+
+func (m fieldMap) lookup(column string) []int {
+	if index, ok := m.tagged[column]; ok {
+		return index
+	}
+	return m.named[normalizeName(column)]
+}
+
+var fieldMapCache sync.Map
+
+func structFields(t reflect.Type) fieldMap {
+	if m, ok := fieldMapCache.Load(t); ok {
+		return m.(fieldMap)
+	}
+
+	m := fieldMap{
+		tagged: make(map[string][]int),
+		named:  make(map[string][]int),
+	}
+	collectFields(t, nil, m, make(map[reflect.Type]bool))
+	fieldMapCache.Store(t, m)
+	return m
+}
+
+func collectFields(t reflect.Type, parent []int, m fieldMap, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	var embedded []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get(TagName)
+		if tag == "-" {
+			continue
+		}
+
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+
+		if f.Anonymous && len(tag) < 1 {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				if f.PkgPath != "" {
+					// Pointers to unexported embedded structs cannot be allocated.
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isValueType(ft) {
+				f.Index = index
+				embedded = append(embedded, f)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if 0 < len(tag) {
+			if _, ok := m.tagged[tag]; !ok {
+				m.tagged[tag] = index
+			}
+			continue
+		}
+		if _, ok := m.named[normalizeName(f.Name)]; !ok {
+			m.named[normalizeName(f.Name)] = index
+		}
+	}
+
+	// Fields of the outer struct take precedence over fields of embedded structs.
+	for _, f := range embedded {
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		collectFields(ft, f.Index, m, visited)
+	}
+}
+
+func normalizeName(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, "_", ""))
+}
+
+// fieldByIndex returns the field of the struct, allocating nil pointers to embedded structs on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if 0 < i && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
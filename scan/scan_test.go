@@ -0,0 +1,134 @@
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mithrandie/ternary"
+
+	_ "github.com/mithrandie/csvq-driver"
+)
+
+var testDataDir = filepath.Join("..", "testdata")
+
+type base struct {
+	ID int `csvq:"id"`
+}
+
+type item struct {
+	base
+	Price     *float64
+	Active    ternary.Value `csvq:"active"`
+	CreatedAt *time.Time    `csvq:"created"`
+	Name      sql.NullString
+	Ignored   string `csvq:"-"`
+}
+
+func query(t *testing.T, queryString string) *sql.Rows {
+	t.Helper()
+
+	db, err := sql.Open("csvq", testDataDir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	rows, err := db.QueryContext(context.Background(), queryString)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	return rows
+}
+
+func TestScanAll(t *testing.T) {
+	rows := query(t, "SELECT id, price, active, created, name, 'x' AS unmapped FROM types ORDER BY id")
+
+	var items []item
+	if err := ScanAll(rows, &items); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	price1, price2 := 1.5, 2.0
+	created1 := time.Date(2026, 1, 2, 10, 0, 0, 0, time.Local)
+	created2 := time.Date(2026, 1, 3, 11, 30, 0, 0, time.Local)
+	expect := []item{
+		{base: base{ID: 1}, Price: &price1, Active: ternary.TRUE, CreatedAt: &created1, Name: sql.NullString{String: "apple", Valid: true}},
+		{base: base{ID: 2}, Price: &price2, Active: ternary.FALSE, CreatedAt: &created2},
+		{base: base{ID: 3}, Active: ternary.TRUE, Name: sql.NullString{String: "banana", Valid: true}},
+	}
+	if !reflect.DeepEqual(items, expect) {
+		t.Fatalf("items = %+v, want %+v", items, expect)
+	}
+}
+
+func TestScanAll_Pointers(t *testing.T) {
+	rows := query(t, "SELECT col1, col2 FROM `table.csv`")
+
+	type record struct {
+		Col1 int
+		Col2 string
+	}
+	var records []*record
+	if err := ScanAll(rows, &records); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if len(records) != 3 || *records[2] != (record{Col1: 3, Col2: "str3"}) {
+		t.Fatalf("records = %+v, unexpected result", records)
+	}
+}
+
+func TestScanOne(t *testing.T) {
+	var it item
+	if err := ScanOne(query(t, "SELECT id, name FROM types WHERE id = 3"), &it); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if it.ID != 3 || it.Name.String != "banana" {
+		t.Fatalf("item = %+v, unexpected result", it)
+	}
+
+	if err := ScanOne(query(t, "SELECT id FROM types WHERE id = 4"), &it); err != sql.ErrNoRows {
+		t.Fatalf("error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	if err := ScanOne(query(t, "SELECT id FROM types"), it); err == nil {
+		t.Fatal("no error, want error for a non-pointer destination")
+	}
+
+	var strict struct {
+		Price float64
+	}
+	if err := ScanOne(query(t, "SELECT price FROM types WHERE id = 3"), &strict); err == nil {
+		t.Fatal("no error, want error for a null value")
+	}
+}
+
+func TestIterator(t *testing.T) {
+	it := NewIterator(query(t, "SELECT id, active FROM types ORDER BY id"))
+	defer func() {
+		_ = it.Close()
+	}()
+
+	var ids []int
+	for it.Next() {
+		var v struct {
+			ID     uint8
+			Active bool
+		}
+		if err := it.Scan(&v); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		ids = append(ids, int(v.ID))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Fatalf("ids = %v, want %v", ids, []int{1, 2, 3})
+	}
+}
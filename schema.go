@@ -0,0 +1,504 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+	"github.com/mithrandie/csvq/lib/value"
+	"github.com/mithrandie/ternary"
+)
+
+const InformationSchema = "information_schema"
+
+const (
+	InformationSchemaTables  = InformationSchema + ".tables"
+	InformationSchemaColumns = InformationSchema + ".columns"
+)
+
+const (
+	TypeNull     = "NULL"
+	TypeString   = "STRING"
+	TypeInteger  = "INTEGER"
+	TypeFloat    = "FLOAT"
+	TypeBoolean  = "BOOLEAN"
+	TypeDatetime = "DATETIME"
+)
+
+// Number of records used to infer the types of columns.
+const typeInferenceSampleSize = 1000
+
+var tableExtensions = []string{
+	option.CsvExt,
+	option.TsvExt,
+	option.JsonExt,
+	option.JsonlExt,
+	option.LtsvExt,
+	option.TextExt,
+}
+
+type TableInfo struct {
+	Name      string
+	Path      string
+	Format    string
+	Delimiter string
+	Encoding  string
+	NoHeader  bool
+	Columns   []ColumnInfo
+}
+
+type ColumnInfo struct {
+	Name     string
+	Position int
+	Type     string
+	Nullable bool
+}
+
+// Tables returns the tables in the repository of the connection.
+// Columns of the returned tables are not loaded, use DescribeTable to get them.
+func (c *Conn) Tables(_ context.Context) ([]TableInfo, error) {
+	if c.proc == nil {
+		return nil, driver.ErrBadConn
+	}
+	return c.listTables()
+}
+
+// DescribeTable loads the table and returns the table with its columns.
+func (c *Conn) DescribeTable(ctx context.Context, name string) (TableInfo, error) {
+	if c.proc == nil {
+		return TableInfo{}, driver.ErrBadConn
+	}
+
+	info, err := c.describeTable(ctx, name)
+	if err != nil {
+		return info, err
+	}
+	return info, c.releaseAfterLoading(ctx)
+}
+
+func (c *Conn) describeTable(ctx context.Context, name string) (TableInfo, error) {
+	if err := c.checkPath(nil, name); err != nil {
+		return TableInfo{Name: name}, err
+	}
+	if err := c.stageTables([]string{name}); err != nil {
+		return TableInfo{Name: name}, err
+	}
+
+	identifier := name
+	if p, ok, err := c.extractTable(name, false); err != nil {
+		return TableInfo{Name: name}, err
+	} else if ok {
+		identifier = p
+	}
+
+	scope := c.proc.ReferenceScope.CreateNode()
+	defer scope.CloseCurrentNode()
+
+	view, err := query.LoadViewFromTableIdentifier(ctx, scope, parser.Identifier{Literal: identifier}, false, false)
+	if err != nil {
+		return TableInfo{Name: name}, err
+	}
+
+	info := TableInfo{Name: name}
+	if view.FileInfo != nil {
+		info = newTableInfo(name, view.FileInfo)
+	}
+
+	flags := c.proc.Tx.Flags
+	columns := view.Header.TableColumnNames()
+	info.Columns = make([]ColumnInfo, 0, len(columns))
+	for i := range columns {
+		typ, nullable := inferColumnType(view, i, flags)
+		info.Columns = append(info.Columns, ColumnInfo{
+			Name:     columns[i],
+			Position: i + 1,
+			Type:     typ,
+			Nullable: nullable,
+		})
+	}
+	return info, nil
+}
+
+// releaseAfterLoading releases the loaded files in auto-commit mode, as the processor does after an execution.
+func (c *Conn) releaseAfterLoading(ctx context.Context) error {
+	if !c.proc.Tx.AutoCommit {
+		return nil
+	}
+	return c.proc.AutoCommit(ctx)
+}
+
+// Tables returns the tables in the repository of the connection.
+func Tables(ctx context.Context, conn *sql.Conn) ([]TableInfo, error) {
+	var tables []TableInfo
+	err := conn.Raw(func(driverConn interface{}) (err error) {
+		tables, err = driverConn.(*Conn).Tables(ctx)
+		return err
+	})
+	return tables, err
+}
+
+// DescribeTable returns the table with its columns.
+func DescribeTable(ctx context.Context, conn *sql.Conn, name string) (TableInfo, error) {
+	var info TableInfo
+	err := conn.Raw(func(driverConn interface{}) (err error) {
+		info, err = driverConn.(*Conn).DescribeTable(ctx, name)
+		return err
+	})
+	return info, err
+}
+
+func repositoryPath(flags *option.Flags) (string, error) {
+	if 0 < len(flags.Repository) {
+		return flags.Repository, nil
+	}
+	return os.Getwd()
+}
+
+func (c *Conn) listTables() ([]TableInfo, error) {
+	if c.fs != nil {
+		if err := c.fs.stageAll(c.isLoaded); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := c.proc.Tx.Flags
+	repository, err := repositoryPath(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]TableInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !isTableFile(entry.Name()) {
+			continue
+		}
+
+		fileInfo, err := query.NewFileInfo(parser.Identifier{Literal: entry.Name()}, repository, flags.ImportOptions, flags.ImportOptions.Format)
+		if err != nil {
+			continue
+		}
+		tables = append(tables, newTableInfo(entry.Name(), fileInfo))
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Name < tables[j].Name
+	})
+	return tables, nil
+}
+
+func isTableFile(name string) bool {
+	if strings.HasSuffix(strings.ToLower(name), SchemaFileSuffix) {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range tableExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func newTableInfo(name string, fileInfo *query.FileInfo) TableInfo {
+	info := TableInfo{
+		Name:     name,
+		Path:     fileInfo.Path,
+		Format:   fileInfo.Format.String(),
+		Encoding: fileInfo.Encoding.String(),
+		NoHeader: fileInfo.NoHeader,
+	}
+	switch fileInfo.Format {
+	case option.CSV, option.TSV:
+		info.Delimiter = string(fileInfo.Delimiter)
+	}
+	return info
+}
+
+func inferColumnType(view *query.View, index int, flags *option.Flags) (string, bool) {
+	typ := TypeNull
+	nullable := false
+
+	for i := 0; i < view.RecordLen() && i < typeInferenceSampleSize; i++ {
+		t := primaryType(view.RecordSet[i][index][0], flags)
+		switch {
+		case t == TypeNull:
+			nullable = true
+		case typ == TypeNull || typ == t:
+			typ = t
+		case (typ == TypeInteger && t == TypeFloat) || (typ == TypeFloat && t == TypeInteger):
+			typ = TypeFloat
+		default:
+			typ = TypeString
+		}
+	}
+	return typ, nullable
+}
+
+func primaryType(p value.Primary, flags *option.Flags) string {
+	switch p.(type) {
+	case *value.Integer:
+		return TypeInteger
+	case *value.Float:
+		return TypeFloat
+	case *value.Boolean, *value.Ternary:
+		return TypeBoolean
+	case *value.Datetime:
+		return TypeDatetime
+	case *value.String:
+		s := strings.TrimSpace(p.(*value.String).Raw())
+		if len(s) < 1 {
+			return TypeNull
+		}
+		if !value.IsNull(value.ToIntegerStrictly(p)) {
+			return TypeInteger
+		}
+		if !value.IsNull(value.ToFloat(p)) {
+			return TypeFloat
+		}
+		if t, err := ternary.ConvertFromString(s); err == nil && t != ternary.UNKNOWN {
+			return TypeBoolean
+		}
+		if _, ok := value.StrToTime(s, flags.DatetimeFormat, flags.GetTimeLocation()); ok {
+			return TypeDatetime
+		}
+		return TypeString
+	}
+	return TypeNull
+}
+
+func isInformationSchema(name string) bool {
+	return strings.EqualFold(name, InformationSchema)
+}
+
+// declareVirtualTables declares the tables of the information schema referred by the statements as temporary tables.
+// The returned function disposes the declared tables.
+func (c *Conn) declareVirtualTables(ctx context.Context, statements []parser.Statement) (func(), error) {
+	var declared []string
+	dispose := func() {
+		for _, name := range declared {
+			_ = c.proc.ReferenceScope.DisposeTemporaryTable(parser.Identifier{Literal: name})
+		}
+	}
+
+	for _, name := range referencedTables(statements) {
+		var view *query.View
+		var err error
+
+		switch {
+		case strings.EqualFold(name, InformationSchemaTables):
+			view, err = c.informationSchemaTables(name)
+		case strings.EqualFold(name, InformationSchemaColumns):
+			view, err = c.informationSchemaColumns(ctx, name, statements)
+		default:
+			continue
+		}
+		if err != nil {
+			dispose()
+			return nil, err
+		}
+
+		if c.proc.ReferenceScope.TemporaryTableExists(name) {
+			continue
+		}
+		c.proc.ReferenceScope.SetTemporaryTable(view)
+		declared = append(declared, name)
+	}
+	return dispose, nil
+}
+
+func newVirtualView(name string, columns []string, records []query.Record) *query.View {
+	view := query.NewView()
+	view.Header = query.NewHeader(name, columns)
+	view.RecordSet = records
+	view.FileInfo = query.NewTemporaryTableFileInfo(name)
+	view.CreateRestorePoint()
+	return view
+}
+
+func (c *Conn) informationSchemaTables(name string) (*query.View, error) {
+	tables, err := c.listTables()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]query.Record, 0, len(tables))
+	for _, t := range tables {
+		records = append(records, query.NewRecord([]value.Primary{
+			value.NewString(t.Name),
+			value.NewString(t.Path),
+			value.NewString(t.Format),
+			value.NewString(t.Delimiter),
+			value.NewString(t.Encoding),
+			value.NewBoolean(t.NoHeader),
+		}))
+	}
+
+	columns := []string{"table_name", "path", "format", "delimiter", "encoding", "no_header"}
+	return newVirtualView(name, columns, records), nil
+}
+
+// informationSchemaColumns loads the tables to build information_schema.columns.
+// If every query that refers to it filters table_name by values, only the tables of the values are loaded.
+func (c *Conn) informationSchemaColumns(ctx context.Context, name string, statements []parser.Statement) (*query.View, error) {
+	tables, err := c.listTables()
+	if err != nil {
+		return nil, err
+	}
+
+	if filter, ok := c.filteredTableNames(ctx, name, statements); ok {
+		filtered := tables[:0]
+		for _, t := range tables {
+			if filter[strings.ToUpper(t.Name)] {
+				filtered = append(filtered, t)
+			}
+		}
+		tables = filtered
+	}
+
+	var records []query.Record
+	for _, t := range tables {
+		info, err := c.describeTable(ctx, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range info.Columns {
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(t.Name),
+				value.NewString(col.Name),
+				value.NewInteger(int64(col.Position)),
+				value.NewString(col.Type),
+				value.NewBoolean(col.Nullable),
+			}))
+		}
+	}
+
+	columns := []string{"table_name", "column_name", "ordinal_position", "data_type", "is_nullable"}
+	return newVirtualView(name, columns, records), nil
+}
+
+// filteredTableNames returns the upper-cased table names to which the WHERE clauses of the queries referring to the
+// virtual table limit table_name, such as "table_name = 'users.csv'" or "table_name IN ('users.csv', 'items.csv')".
+// The second result is false if any query refers to the virtual table without such a filter.
+func (c *Conn) filteredTableNames(ctx context.Context, name string, statements []parser.Statement) (map[string]bool, bool) {
+	isTarget := func(expr parser.QueryExpression) bool {
+		n, ok := tableObjectName(expr)
+		return ok && strings.EqualFold(n, name)
+	}
+
+	references := 0
+	walkStatements(statements, func(node interface{}) bool {
+		if t, ok := node.(parser.Table); ok && isTarget(t.Object) {
+			references++
+		}
+		return true
+	})
+
+	names := make(map[string]bool)
+	filtered := 0
+	walkStatements(statements, func(node interface{}) bool {
+		entity, ok := node.(parser.SelectEntity)
+		if !ok {
+			return true
+		}
+		from, ok := entity.FromClause.(parser.FromClause)
+		if !ok || len(from.Tables) != 1 {
+			return true
+		}
+		table, ok := from.Tables[0].(parser.Table)
+		if !ok || !isTarget(table.Object) {
+			return true
+		}
+		where, ok := entity.WhereClause.(parser.WhereClause)
+		if !ok {
+			return true
+		}
+		if values, ok := c.tableNameFilter(ctx, where.Filter); ok {
+			for _, v := range values {
+				names[strings.ToUpper(v)] = true
+			}
+			filtered++
+		}
+		return true
+	})
+
+	return names, 0 < references && filtered == references
+}
+
+// tableNameFilter returns the values to which the condition limits table_name.
+func (c *Conn) tableNameFilter(ctx context.Context, expr parser.QueryExpression) ([]string, bool) {
+	switch e := expr.(type) {
+	case parser.Parentheses:
+		return c.tableNameFilter(ctx, e.Expr)
+	case parser.Logic:
+		if e.Operator.Token != parser.AND {
+			return nil, false
+		}
+		if values, ok := c.tableNameFilter(ctx, e.LHS); ok {
+			return values, true
+		}
+		return c.tableNameFilter(ctx, e.RHS)
+	case parser.Comparison:
+		if e.Operator.Literal != "=" {
+			return nil, false
+		}
+		if isTableNameField(e.LHS) {
+			return c.filterValues(ctx, []parser.QueryExpression{e.RHS})
+		}
+		if isTableNameField(e.RHS) {
+			return c.filterValues(ctx, []parser.QueryExpression{e.LHS})
+		}
+	case parser.In:
+		if e.IsNegated() || !isTableNameField(e.LHS) {
+			return nil, false
+		}
+		if row, ok := e.Values.(parser.RowValue); ok {
+			if list, ok := row.Value.(parser.ValueList); ok {
+				return c.filterValues(ctx, list.Values)
+			}
+		}
+	}
+	return nil, false
+}
+
+func isTableNameField(expr parser.QueryExpression) bool {
+	if f, ok := expr.(parser.FieldReference); ok {
+		if id, ok := f.Column.(parser.Identifier); ok {
+			return strings.EqualFold(id.Literal, "table_name")
+		}
+	}
+	return false
+}
+
+// filterValues evaluates the values of a filter, which must be constants or placeholders.
+func (c *Conn) filterValues(ctx context.Context, exprs []parser.QueryExpression) ([]string, bool) {
+	values := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		switch expr.(type) {
+		case parser.PrimitiveType, parser.Placeholder:
+		default:
+			return nil, false
+		}
+		p, err := query.Evaluate(ctx, c.proc.ReferenceScope, expr)
+		if err != nil {
+			return nil, false
+		}
+		s, ok := p.(*value.String)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, s.Raw())
+	}
+	return values, true
+}
@@ -0,0 +1,228 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+func TestTables(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	tables, err := Tables(ctx, conn)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	expect := []TableInfo{
+		{Name: "table.csv", Path: filepath.Join(SchemaTestDir, "table.csv"), Format: "CSV", Delimiter: ",", Encoding: "AUTO"},
+		{Name: "types.csv", Path: filepath.Join(SchemaTestDir, "types.csv"), Format: "CSV", Delimiter: ",", Encoding: "AUTO"},
+	}
+	if !reflect.DeepEqual(tables, expect) {
+		t.Fatalf("tables = %v, want %v", tables, expect)
+	}
+}
+
+func TestDescribeTable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	info, err := DescribeTable(ctx, conn, "types")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	expect := []ColumnInfo{
+		{Name: "id", Position: 1, Type: TypeInteger, Nullable: false},
+		{Name: "price", Position: 2, Type: TypeFloat, Nullable: true},
+		{Name: "active", Position: 3, Type: TypeBoolean, Nullable: false},
+		{Name: "created", Position: 4, Type: TypeDatetime, Nullable: true},
+		{Name: "name", Position: 5, Type: TypeString, Nullable: true},
+	}
+	if info.Path != filepath.Join(SchemaTestDir, "types.csv") {
+		t.Fatalf("path = %q, want %q", info.Path, filepath.Join(SchemaTestDir, "types.csv"))
+	}
+	if !reflect.DeepEqual(info.Columns, expect) {
+		t.Fatalf("columns = %v, want %v", info.Columns, expect)
+	}
+
+	if _, err = DescribeTable(ctx, conn, "notexist"); err == nil {
+		t.Fatal("no error, want error for a table that does not exist")
+	}
+}
+
+func TestInformationSchema(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	queryString := "SELECT table_name, format FROM information_schema.tables ORDER BY table_name"
+	rs, err := db.QueryContext(ctx, queryString)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	var tables [][]string
+	for rs.Next() {
+		var name, format string
+		if err := rs.Scan(&name, &format); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		tables = append(tables, []string{name, format})
+	}
+	_ = rs.Close()
+
+	expectTables := [][]string{{"table.csv", "CSV"}, {"types.csv", "CSV"}}
+	if !reflect.DeepEqual(tables, expectTables) {
+		t.Fatalf("tables = %v, want %v", tables, expectTables)
+	}
+
+	queryString = "SELECT column_name, data_type FROM information_schema.columns WHERE table_name = ? ORDER BY ordinal_position"
+	rs, err = db.QueryContext(ctx, queryString, "table.csv")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	var columns [][]string
+	for rs.Next() {
+		var name, typ string
+		if err := rs.Scan(&name, &typ); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		columns = append(columns, []string{name, typ})
+	}
+	_ = rs.Close()
+
+	expectColumns := [][]string{{"col1", TypeInteger}, {"col2", TypeString}}
+	if !reflect.DeepEqual(columns, expectColumns) {
+		t.Fatalf("columns = %v, want %v", columns, expectColumns)
+	}
+
+	if _, err = db.ExecContext(ctx, "SELECT * FROM `table.csv`"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+}
+
+var filteredTableNamesTests = []struct {
+	Query  string
+	Values []parser.ReplaceValue
+	Result map[string]bool
+	OK     bool
+}{
+	{
+		Query:  "SELECT * FROM information_schema.columns WHERE table_name = 'table.csv'",
+		Result: map[string]bool{"TABLE.CSV": true},
+		OK:     true,
+	},
+	{
+		Query:  "SELECT * FROM information_schema.columns WHERE data_type = 'STRING' AND table_name IN ('table.csv', 'types.csv')",
+		Result: map[string]bool{"TABLE.CSV": true, "TYPES.CSV": true},
+		OK:     true,
+	},
+	{
+		Query:  "SELECT * FROM information_schema.columns WHERE table_name = ?",
+		Values: []parser.ReplaceValue{{Value: parser.NewStringValue("types.csv")}},
+		Result: map[string]bool{"TYPES.CSV": true},
+		OK:     true,
+	},
+	{
+		Query: "SELECT * FROM information_schema.columns",
+		OK:    false,
+	},
+	{
+		Query: "SELECT * FROM information_schema.columns WHERE table_name = 'table.csv' OR data_type = 'STRING'",
+		OK:    false,
+	},
+	{
+		Query: "SELECT * FROM information_schema.columns WHERE table_name LIKE 'table%'",
+		OK:    false,
+	},
+	{
+		Query: "SELECT * FROM information_schema.columns WHERE table_name = 'table.csv' UNION SELECT * FROM information_schema.columns",
+		OK:    false,
+	},
+}
+
+func TestConn_FilteredTableNames(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	c, err := NewConn(ctx, SchemaTestDir, waitTimeoutForTests, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	for _, v := range filteredTableNamesTests {
+		statements, _, err := parser.Parse(quoteQualifiedNames(v.Query, false, isInformationSchema), "", true, false)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %q", v.Query, err.Error())
+		}
+		result, ok := c.filteredTableNames(query.ContextForPreparedStatement(ctx, query.NewReplaceValues(v.Values)), InformationSchemaColumns, statements)
+		if ok != v.OK {
+			t.Errorf("%s: ok = %t, want %t", v.Query, ok, v.OK)
+			continue
+		}
+		if ok && !reflect.DeepEqual(result, v.Result) {
+			t.Errorf("%s: result = %v, want %v", v.Query, result, v.Result)
+		}
+	}
+}
+
+func TestConn_TablesClosed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	c, err := NewConn(ctx, SchemaTestDir, waitTimeoutForTests, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if err = c.Close(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	if _, err = c.Tables(ctx); err != driver.ErrBadConn {
+		t.Fatalf("error = %v, want error %q", err, driver.ErrBadConn)
+	}
+	if _, err = c.DescribeTable(ctx, "table.csv"); err != driver.ErrBadConn {
+		t.Fatalf("error = %v, want error %q", err, driver.ErrBadConn)
+	}
+}
@@ -35,3 +35,44 @@ func SetStdout(w io.WriteCloser) {
 func SetOutFile(w io.Writer) {
 	getSession().SetOutFile(w)
 }
+
+type outputContextKey struct{}
+
+// WithOutput returns a context that makes statements executed with it write their outputs to w
+// instead of the stdout of the session.
+// The outputs are logs, printed messages and result-sets of select queries encoded in the format of @@FORMAT.
+func WithOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, outputContextKey{}, w)
+}
+
+type writeCloser struct {
+	io.Writer
+}
+
+func (w writeCloser) Close() error {
+	return nil
+}
+
+// replaceOutput replaces the session of the transaction with a new session whose stdout is the writer passed by WithOutput.
+// The new session reads and writes the other streams of the original session.
+// The returned function restores the original session.
+func replaceOutput(ctx context.Context, tx *query.Transaction) func() {
+	w, ok := ctx.Value(outputContextKey{}).(io.Writer)
+	if !ok || w == nil {
+		return func() {}
+	}
+
+	orig := tx.Session
+	sess := query.NewSession()
+	if err := sess.SetStdinContext(ctx, orig.Stdin()); err == nil {
+		sess.CanReadStdin = orig.CanReadStdin
+	}
+	sess.SetStdout(writeCloser{Writer: w})
+	sess.SetStderr(orig.Stderr())
+	sess.SetTerminal(orig.Terminal())
+	tx.Session = sess
+
+	return func() {
+		tx.Session = orig
+	}
+}
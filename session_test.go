@@ -0,0 +1,45 @@
+package csvq
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+func TestWithOutput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	stdout := query.NewOutput()
+	SetStdout(stdout)
+	defer SetStdout(&query.Discard{})
+
+	db, _ := sql.Open("csvq", TestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	buf := &bytes.Buffer{}
+	queryString := "PRINT 'message'; SET @@FORMAT TO JSON; SELECT INTEGER(col1) AS col1 FROM `table_q.csv` WHERE col1 = 1;"
+	if _, err := db.ExecContext(WithOutput(ctx, buf), queryString); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	expect := "'message'\n[{\"col1\":1}]\n"
+	if buf.String() != expect {
+		t.Fatalf("output = %q, want %q", buf.String(), expect)
+	}
+	if stdout.String() != "" {
+		t.Fatalf("stdout = %q, want empty", stdout.String())
+	}
+
+	if _, err := db.ExecContext(ctx, "PRINT 'to stdout';"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if stdout.String() != "'to stdout'\n" {
+		t.Fatalf("stdout = %q, want %q", stdout.String(), "'to stdout'\n")
+	}
+}
@@ -0,0 +1,358 @@
+package csvq
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+	"github.com/mithrandie/csvq/lib/value"
+	"github.com/mithrandie/ternary"
+)
+
+const (
+	objectStatusFixed    = "Fixed"
+	objectStatusCreated  = "Created"
+	objectStatusUpdated  = "Updated"
+	objectStatusReadOnly = "Read-Only"
+)
+
+type showResultsContextKey struct{}
+
+// contextForShowResults returns a context to return the results of SHOW statements as result sets
+// instead of writing them to the output.
+func contextForShowResults(ctx context.Context) context.Context {
+	return context.WithValue(ctx, showResultsContextKey{}, true)
+}
+
+func returnsShowResults(ctx context.Context) bool {
+	b, ok := ctx.Value(showResultsContextKey{}).(bool)
+	return ok && b
+}
+
+func isShowStatement(stmt parser.Statement) bool {
+	switch stmt.(type) {
+	case parser.ShowObjects, parser.ShowFields, parser.ShowFlag:
+		return true
+	}
+	return false
+}
+
+// executeWithShowResults executes the statements with the processor. If the context is created by contextForShowResults,
+// SHOW statements at the top level are executed by the driver and their results are added to the selected views
+// in order of appearance.
+// SHOW statements in child scopes, such as inside of IF, WHILE and user-defined functions, are executed by the
+// processor and their results are written to the output.
+func executeWithShowResults(ctx context.Context, proc *query.Processor, statements []parser.Statement) (query.StatementFlow, error) {
+	if !returnsShowResults(ctx) {
+		return proc.Execute(ctx, statements)
+	}
+
+	execCtx, targets := expandPreparedStatement(ctx, proc, statements)
+
+	containsShow := false
+	for _, stmt := range targets {
+		if isShowStatement(stmt) {
+			containsShow = true
+			break
+		}
+	}
+	if !containsShow {
+		return proc.Execute(ctx, statements)
+	}
+
+	var selectedViews []*query.View
+	var affectedRows int
+	defer func() {
+		proc.Tx.SelectedViews = selectedViews
+		proc.Tx.AffectedRows = affectedRows
+	}()
+
+	flow := query.Terminate
+	start := 0
+	for i := 0; i <= len(targets); i++ {
+		if i < len(targets) && !isShowStatement(targets[i]) {
+			continue
+		}
+
+		if start < i {
+			var err error
+			if flow, err = proc.Execute(execCtx, targets[start:i]); err != nil {
+				return flow, err
+			}
+			selectedViews = append(selectedViews, proc.Tx.SelectedViews...)
+			affectedRows += proc.Tx.AffectedRows
+			if flow != query.Terminate {
+				return flow, nil
+			}
+		}
+		if i == len(targets) {
+			break
+		}
+
+		if err := execCtx.Err(); err != nil {
+			return query.TerminateWithError, query.ConvertContextError(err)
+		}
+		view, err := showView(execCtx, proc, targets[i])
+		if err != nil {
+			return query.TerminateWithError, err
+		}
+		selectedViews = append(selectedViews, view)
+		start = i + 1
+	}
+	return flow, nil
+}
+
+func showView(ctx context.Context, proc *query.Processor, stmt parser.Statement) (*query.View, error) {
+	switch stmt.(type) {
+	case parser.ShowFlag:
+		return showFlagView(proc, stmt.(parser.ShowFlag))
+	case parser.ShowFields:
+		return showFieldsView(ctx, proc, stmt.(parser.ShowFields))
+	default:
+		return showObjectsView(proc, stmt.(parser.ShowObjects))
+	}
+}
+
+func newResultView(columns []string, records []query.Record) *query.View {
+	view := query.NewView()
+	view.Header = query.NewHeader("", columns)
+	view.RecordSet = records
+	return view
+}
+
+func newStringOrNull(s string) value.Primary {
+	if len(s) < 1 {
+		return value.NewNull()
+	}
+	return value.NewString(s)
+}
+
+func showFlagView(proc *query.Processor, expr parser.ShowFlag) (*query.View, error) {
+	p, ok := proc.Tx.GetFlag(expr.Flag.Name)
+	if !ok {
+		return nil, query.NewInvalidFlagNameError(expr.Flag)
+	}
+
+	records := []query.Record{
+		query.NewRecord([]value.Primary{value.NewString(option.FlagSymbol(strings.ToUpper(expr.Flag.Name))), p}),
+	}
+	return newResultView([]string{"name", "value"}, records), nil
+}
+
+func showFieldsView(ctx context.Context, proc *query.Processor, expr parser.ShowFields) (*query.View, error) {
+	if !strings.EqualFold(expr.Type.Literal, "FIELDS") {
+		return nil, query.NewShowInvalidObjectTypeError(expr, expr.Type.Literal)
+	}
+
+	scope := proc.ReferenceScope.CreateNode()
+	defer scope.CloseCurrentNode()
+
+	view, err := query.LoadViewFromTableIdentifier(ctx, scope, expr.Table, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := view.Header.TableColumnNames()
+	records := make([]query.Record, 0, len(columns))
+	for i, name := range columns {
+		records = append(records, query.NewRecord([]value.Primary{
+			value.NewInteger(int64(i + 1)),
+			value.NewString(name),
+		}))
+	}
+	return newResultView([]string{"ordinal_position", "column_name"}, records), nil
+}
+
+// showObjectsView builds the result of SHOW TABLES, VIEWS, CURSORS, FUNCTIONS, STATEMENTS, FLAGS, ENV and RUNINFO
+// from the objects of the processor. csvq formats the results of SHOW statements only as text for the output,
+// so the views are built by the driver and the columns follow the fields of the text.
+func showObjectsView(proc *query.Processor, expr parser.ShowObjects) (*query.View, error) {
+	scope := proc.ReferenceScope
+	tx := proc.Tx
+
+	var columns []string
+	var records []query.Record
+
+	switch strings.ToUpper(expr.Type.Literal) {
+	case query.ShowTables:
+		columns = []string{"path", "fields", "format", "delimiter", "encoding", "line_break", "no_header", "status"}
+		createdFiles, updatedFiles := tx.UncommittedViews.UncommittedFiles()
+
+		for _, key := range tx.CachedViews.SortedKeys() {
+			view, ok := tx.CachedViews.Load(strings.ToUpper(key))
+			if !ok {
+				continue
+			}
+
+			info := view.FileInfo
+			status := objectStatusFixed
+			if _, ok := createdFiles[strings.ToUpper(info.Path)]; ok {
+				status = objectStatusCreated
+			} else if _, ok := updatedFiles[strings.ToUpper(info.Path)]; ok {
+				status = objectStatusUpdated
+			}
+
+			var delimiter string
+			switch info.Format {
+			case option.CSV, option.TSV:
+				delimiter = string(info.Delimiter)
+			}
+
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(info.Path),
+				value.NewString(strings.Join(view.Header.TableColumnNames(), ",")),
+				value.NewString(info.Format.String()),
+				newStringOrNull(delimiter),
+				value.NewString(info.Encoding.String()),
+				value.NewString(info.LineBreak.String()),
+				value.NewBoolean(info.NoHeader),
+				value.NewString(status),
+			}))
+		}
+	case query.ShowViews:
+		columns = []string{"name", "fields", "status"}
+		views := scope.AllTemporaryTables()
+		updatedViews := tx.UncommittedViews.UncommittedTempViews()
+
+		for _, key := range views.SortedKeys() {
+			view, ok := views.Load(key)
+			if !ok {
+				continue
+			}
+
+			status := objectStatusFixed
+			if _, ok := updatedViews[strings.ToUpper(view.FileInfo.Path)]; ok {
+				status = objectStatusUpdated
+			}
+
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(view.FileInfo.Path),
+				value.NewString(strings.Join(view.Header.TableColumnNames(), ",")),
+				value.NewString(status),
+			}))
+		}
+	case query.ShowCursors:
+		columns = []string{"name", "is_open", "number_of_rows", "pointer"}
+		cursors := scope.AllCursors()
+
+		for _, key := range cursors.SortedKeys() {
+			cur, ok := cursors.Load(key)
+			if !ok {
+				continue
+			}
+
+			numberOfRows := value.Primary(value.NewNull())
+			pointer := value.Primary(value.NewNull())
+			isOpen := cur.IsOpen() == ternary.TRUE
+			if isOpen {
+				nor, _ := cur.Count()
+				numberOfRows = value.NewInteger(int64(nor))
+				if inRange, _ := cur.IsInRange(); inRange == ternary.TRUE {
+					position, _ := cur.Pointer()
+					pointer = value.NewInteger(int64(position))
+				}
+			}
+
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(cur.Name),
+				value.NewBoolean(isOpen),
+				numberOfRows,
+				pointer,
+			}))
+		}
+	case query.ShowFunctions:
+		columns = []string{"name", "type", "parameters"}
+		scalars, aggs := scope.AllFunctions()
+
+		appendFunctions := func(funcs query.UserDefinedFunctionMap, typ string) {
+			for _, key := range funcs.SortedKeys() {
+				fn, ok := funcs.Load(key)
+				if !ok {
+					continue
+				}
+
+				params := make([]string, 0, len(fn.Parameters)+1)
+				if fn.IsAggregate {
+					params = append(params, fn.Cursor.String())
+				}
+				for _, p := range fn.Parameters {
+					if def, ok := fn.Defaults[p.Name]; ok {
+						params = append(params, p.String()+" = "+def.String())
+					} else {
+						params = append(params, p.String())
+					}
+				}
+
+				records = append(records, query.NewRecord([]value.Primary{
+					value.NewString(fn.Name.String()),
+					value.NewString(typ),
+					value.NewString(strings.Join(params, ", ")),
+				}))
+			}
+		}
+		appendFunctions(scalars, "SCALAR")
+		appendFunctions(aggs, "AGGREGATE")
+	case query.ShowStatements:
+		columns = []string{"name", "placeholder_number", "statement"}
+
+		for _, key := range tx.PreparedStatements.SortedKeys() {
+			stmt, ok := tx.PreparedStatements.Load(key)
+			if !ok {
+				continue
+			}
+
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(stmt.Name),
+				value.NewInteger(int64(stmt.HolderNumber)),
+				value.NewString(stmt.StatementString),
+			}))
+		}
+	case query.ShowFlags:
+		columns = []string{"name", "value"}
+
+		for _, flag := range option.FlagList {
+			p, _ := tx.GetFlag(flag)
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(option.FlagSymbol(flag)),
+				p,
+			}))
+		}
+	case query.ShowEnv:
+		columns = []string{"name", "value"}
+
+		for _, e := range os.Environ() {
+			name := e
+			var val string
+			if i := strings.IndexByte(e, '='); -1 < i {
+				name = e[:i]
+				val = e[i+1:]
+			}
+
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(string(parser.VariableSign) + string(parser.EnvironmentVariableSign) + name),
+				value.NewString(val),
+			}))
+		}
+	case query.ShowRuninfo:
+		columns = []string{"name", "value"}
+
+		for _, ri := range query.RuntimeInformatinList {
+			p, err := query.GetRuntimeInformation(tx, parser.RuntimeInformation{Name: ri})
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, query.NewRecord([]value.Primary{
+				value.NewString(string(parser.VariableSign) + string(parser.RuntimeInformationSign) + ri),
+				p,
+			}))
+		}
+	default:
+		return nil, query.NewShowInvalidObjectTypeError(expr, expr.Type.String())
+	}
+
+	return newResultView(columns, records), nil
+}
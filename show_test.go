@@ -0,0 +1,208 @@
+package csvq
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func queryAll(ctx context.Context, qc QueryerContext, queryString string, args ...interface{}) ([]string, [][]interface{}, error) {
+	rs, err := qc.QueryContext(ctx, queryString, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = rs.Close()
+	}()
+
+	columns, err := rs.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var records [][]interface{}
+	for rs.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, values)
+	}
+	return columns, records, rs.Err()
+}
+
+var showStatementTests = []struct {
+	Name          string
+	Query         string
+	Args          []interface{}
+	ExpectColumns []string
+	ExpectRecords [][]interface{}
+	Error         string
+}{
+	{
+		Name:          "Show Fields",
+		Query:         "SHOW FIELDS FROM `table.csv`",
+		ExpectColumns: []string{"ordinal_position", "column_name"},
+		ExpectRecords: [][]interface{}{
+			{int64(1), "col1"},
+			{int64(2), "col2"},
+		},
+	},
+	{
+		Name:          "Show Flag",
+		Query:         "SET @@FORMAT TO JSON; SHOW @@FORMAT;",
+		ExpectColumns: []string{"name", "value"},
+		ExpectRecords: [][]interface{}{
+			{"@@FORMAT", "JSON"},
+		},
+	},
+	{
+		Name:          "Show Functions",
+		Query:         "DECLARE fn FUNCTION (@a, @b DEFAULT 1) AS BEGIN RETURN @a + @b; END; SHOW FUNCTIONS;",
+		ExpectColumns: []string{"name", "type", "parameters"},
+		ExpectRecords: [][]interface{}{
+			{"fn", "SCALAR", "@a, @b = 1"},
+		},
+	},
+	{
+		Name:          "Show Views",
+		Query:         "DECLARE tmp VIEW (c1, c2); SHOW VIEWS;",
+		ExpectColumns: []string{"name", "fields", "status"},
+		ExpectRecords: [][]interface{}{
+			{"tmp", "c1,c2", "Fixed"},
+		},
+	},
+	{
+		Name:          "Show Statement Followed by Select Query",
+		Query:         "SHOW FIELDS FROM `table.csv`; SELECT col2 FROM `table.csv` WHERE col1 = ?;",
+		Args:          []interface{}{1},
+		ExpectColumns: []string{"ordinal_position", "column_name"},
+		ExpectRecords: [][]interface{}{
+			{int64(1), "col1"},
+			{int64(2), "col2"},
+		},
+	},
+	{
+		Name:  "Show Invalid Object",
+		Query: "SHOW NOTEXIST",
+		Error: "[L:1 C:1] object type NOTEXIST is invalid",
+	},
+}
+
+func TestShowStatements(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	for _, v := range showStatementTests {
+		db, _ := sql.Open("csvq", SchemaTestDir)
+
+		columns, records, err := queryAll(ctx, db, v.Query, v.Args...)
+		_ = db.Close()
+
+		if err != nil {
+			if len(v.Error) < 1 {
+				t.Errorf("%s: unexpected error %q", v.Name, err)
+			} else if err.Error() != v.Error {
+				t.Errorf("%s: error %q, want error %q", v.Name, err.Error(), v.Error)
+			}
+			continue
+		}
+		if 0 < len(v.Error) {
+			t.Errorf("%s: no error, want error %q", v.Name, v.Error)
+			continue
+		}
+		if !reflect.DeepEqual(columns, v.ExpectColumns) {
+			t.Errorf("%s: columns = %v, want %v", v.Name, columns, v.ExpectColumns)
+		}
+		if !reflect.DeepEqual(records, v.ExpectRecords) {
+			t.Errorf("%s: records = %v, want %v", v.Name, records, v.ExpectRecords)
+		}
+	}
+}
+
+func TestShowStatements_NextResultSet(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rs, err := db.QueryContext(ctx, "SHOW @@FORMAT; SELECT col2 FROM `table.csv` WHERE col1 = 2;")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = rs.Close()
+	}()
+
+	var name, format string
+	if !rs.Next() {
+		t.Fatal("no rows in the first result set")
+	}
+	if err := rs.Scan(&name, &format); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if name != "@@FORMAT" || format != "TEXT" {
+		t.Fatalf("result = %q, %q, want %q, %q", name, format, "@@FORMAT", "TEXT")
+	}
+
+	if !rs.NextResultSet() || !rs.Next() {
+		t.Fatal("no rows in the second result set")
+	}
+	var col2 string
+	if err := rs.Scan(&col2); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if col2 != "str2" {
+		t.Fatalf("result = %q, want %q", col2, "str2")
+	}
+}
+
+func TestShowStatements_Exec(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	buf := &bytes.Buffer{}
+	if _, err := db.ExecContext(WithOutput(ctx, buf), "SHOW FIELDS FROM `table.csv`"); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if !strings.Contains(buf.String(), "col2") {
+		t.Fatalf("output = %q, want the fields of the table", buf.String())
+	}
+}
+
+func TestShowStatements_ChildScope(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", SchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	buf := &bytes.Buffer{}
+	columns, records, err := queryAll(WithOutput(ctx, buf), db, "IF TRUE THEN SHOW @@FORMAT; END IF;")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if 0 < len(columns) || 0 < len(records) {
+		t.Fatalf("result = %v, %v, want no result sets", columns, records)
+	}
+	if !strings.Contains(buf.String(), "TEXT") {
+		t.Fatalf("output = %q, want the flag written to the output", buf.String())
+	}
+}
@@ -0,0 +1,363 @@
+package csvq
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+func walkStatements(statements []parser.Statement, fn func(node interface{}) bool) {
+	for i := range statements {
+		walkNode(reflect.ValueOf(statements[i]), fn)
+	}
+}
+
+func walkNode(v reflect.Value, fn func(node interface{}) bool) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if !v.IsNil() {
+			walkNode(v.Elem(), fn)
+		}
+	case reflect.Struct:
+		if v.CanInterface() && !fn(v.Interface()) {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			walkNode(v.Field(i), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkNode(v.Index(i), fn)
+		}
+	}
+}
+
+func tableObjectName(expr parser.QueryExpression) (string, bool) {
+	switch expr.(type) {
+	case parser.Identifier:
+		return expr.(parser.Identifier).Literal, true
+	case parser.FormatSpecifiedFunction:
+		if id, ok := expr.(parser.FormatSpecifiedFunction).Path.(parser.Identifier); ok {
+			return id.Literal, true
+		}
+	}
+	return "", false
+}
+
+// referencedTables returns the table identifiers that the statements refer to, in order of appearance.
+// Identifiers are returned as written, so they can also be names of temporary tables or aliases.
+func referencedTables(statements []parser.Statement) []string {
+	var names []string
+	appendName := func(expr parser.QueryExpression) {
+		name, ok := tableObjectName(expr)
+		if !ok {
+			return
+		}
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+
+	walkStatements(statements, func(node interface{}) bool {
+		switch node.(type) {
+		case parser.Table:
+			appendName(node.(parser.Table).Object)
+		case parser.CreateTable:
+			appendName(node.(parser.CreateTable).Table)
+		case parser.AddColumns:
+			appendName(node.(parser.AddColumns).Table)
+		case parser.DropColumns:
+			appendName(node.(parser.DropColumns).Table)
+		case parser.RenameColumn:
+			appendName(node.(parser.RenameColumn).Table)
+		case parser.SetTableAttribute:
+			appendName(node.(parser.SetTableAttribute).Table)
+		case parser.ShowFields:
+			appendName(node.(parser.ShowFields).Table)
+		}
+		return true
+	})
+	return names
+}
+
+type tablePosition struct {
+	line int
+	char int
+}
+
+// tablePositions returns the positions of the identifiers of the tables whose names match in the statements.
+// The values of the returned map are true if the tables can be given aliases.
+// Inline tables and temporary tables are not returned, and neither are the tables of UPDATE and DELETE statements
+// that refer to the tables in the FROM clauses.
+// If paths is true, the tables of statements that accept only file paths, such as CREATE TABLE, are also returned.
+func (c *Conn) tablePositions(statements []parser.Statement, match func(name string) bool, paths bool) map[tablePosition]bool {
+	inlineTables := make(map[string]bool)
+	walkStatements(statements, func(node interface{}) bool {
+		if t, ok := node.(parser.InlineTable); ok {
+			inlineTables[strings.ToUpper(t.Name.Literal)] = true
+		}
+		return true
+	})
+
+	positions := make(map[tablePosition]bool)
+	references := make(map[tablePosition]bool)
+	position := func(expr parser.QueryExpression) (tablePosition, parser.Table, bool) {
+		table, ok := expr.(parser.Table)
+		if !ok {
+			table = parser.Table{Object: expr}
+		}
+		id, ok := table.Object.(parser.Identifier)
+		if !ok || !id.HasParseInfo() {
+			return tablePosition{}, table, false
+		}
+		return tablePosition{line: id.Line(), char: id.Char()}, table, true
+	}
+	appendTable := func(expr parser.QueryExpression, canBeAliased bool) {
+		p, table, ok := position(expr)
+		if !ok || references[p] {
+			return
+		}
+		name := table.Object.(parser.Identifier).Literal
+		if !match(name) || inlineTables[strings.ToUpper(name)] || c.proc.ReferenceScope.TemporaryTableExists(name) {
+			return
+		}
+		if _, ok := positions[p]; !ok {
+			positions[p] = canBeAliased && table.Alias == nil
+		}
+	}
+	appendReferences := func(tables []parser.QueryExpression) {
+		for _, t := range tables {
+			if p, _, ok := position(t); ok {
+				references[p] = true
+			}
+		}
+	}
+
+	walkStatements(statements, func(node interface{}) bool {
+		switch n := node.(type) {
+		case parser.InsertQuery:
+			appendTable(n.Table, false)
+		case parser.ReplaceQuery:
+			appendTable(n.Table, false)
+		case parser.UpdateQuery:
+			// Tables of UPDATE statements with FROM clauses refer to the tables in the FROM clauses.
+			if n.FromClause == nil {
+				for _, t := range n.Tables {
+					appendTable(t, false)
+				}
+			} else {
+				appendReferences(n.Tables)
+			}
+		case parser.DeleteQuery:
+			// Tables of DELETE statements refer to the tables in the FROM clauses.
+			appendReferences(n.Tables)
+		case parser.AddColumns:
+			appendTable(n.Table, false)
+		case parser.DropColumns:
+			appendTable(n.Table, false)
+		case parser.RenameColumn:
+			appendTable(n.Table, false)
+		case parser.SetTableAttribute:
+			appendTable(n.Table, false)
+		case parser.CreateTable:
+			if paths {
+				appendTable(n.Table, false)
+			}
+		case parser.ShowFields:
+			if paths {
+				appendTable(n.Table, false)
+			}
+		case parser.Table:
+			appendTable(n, true)
+		}
+		return true
+	})
+	return positions
+}
+
+// forEachTablePosition calls fn with the indices of the tokens at the positions returned by tablePositions.
+func forEachTablePosition(tokens []queryToken, positions map[tablePosition]bool, fn func(i int, canBeAliased bool)) {
+	line, char := 1, 1
+	for i := range tokens {
+		literal := tokens[i].literal
+		if canBeAliased, ok := positions[tablePosition{line: line, char: char}]; ok {
+			fn(i, canBeAliased)
+		}
+		line, char = advancePosition(literal, line, char)
+	}
+}
+
+// advancePosition returns the position after the literal in the same way as the scanner of csvq counts lines and characters.
+func advancePosition(literal string, line int, char int) (int, int) {
+	r := []rune(literal)
+	for i := 0; i < len(r); i++ {
+		switch r[i] {
+		case '\r':
+			if i+1 < len(r) && r[i+1] == '\n' {
+				i++
+			}
+			fallthrough
+		case '\n':
+			line++
+			char = 1
+		default:
+			char++
+		}
+	}
+	return line, char
+}
+
+// expandPreparedStatement returns the statements of the prepared statement and the context holding its replace values
+// if the statements consist of an EXECUTE statement. Otherwise, the passed context and statements are returned.
+func expandPreparedStatement(ctx context.Context, proc *query.Processor, statements []parser.Statement) (context.Context, []parser.Statement) {
+	if len(statements) == 1 {
+		if execStmt, ok := statements[0].(parser.ExecuteStatement); ok {
+			if prepared, err := proc.Tx.PreparedStatements.Get(execStmt.Name); err == nil {
+				return query.ContextForPreparedStatement(ctx, query.NewReplaceValues(execStmt.Values)), prepared.Statements
+			}
+		}
+	}
+	return ctx, statements
+}
+
+type executionStats struct {
+	rowsScanned  int
+	bytesRead    int64
+	bytesWritten int64
+	// lockWait and lockRetries are measured only if the connection has metrics.
+	lockWait    time.Duration
+	lockRetries int
+}
+
+// executeStatements executes the statements with the processor.
+// In auto-commit mode, the statements are committed here instead of in the processor
+// so that the loaded and committed files can be observed before the resources are released.
+// If conn is not nil, the tables are staged from the file system of the connection before the execution,
+// and the created or updated tables are validated against their schemas before they are committed.
+// The execution is also restricted by the limits of the connection.
+func executeStatements(ctx context.Context, conn *Conn, proc *query.Processor, statements []parser.Statement) (*executionStats, error) {
+	stats := &executionStats{}
+
+	var targets []parser.Statement
+	var limits Limits
+	if conn != nil {
+		_, targets = expandPreparedStatement(ctx, proc, statements)
+		if err := conn.stageTables(referencedTables(targets)); err != nil {
+			return stats, err
+		}
+		limits = conn.limits
+		if err := limits.checkFileSizes(proc.Tx, targets); err != nil {
+			return stats, err
+		}
+		stats.rowsScanned = cachedRows(proc.Tx, targets)
+		if err := limits.checkFileRows(proc.Tx, targets, stats.rowsScanned); err != nil {
+			return stats, err
+		}
+		if conn.options != nil && conn.options.metrics != nil {
+			stats.lockWait, stats.lockRetries = acquireFileLocks(ctx, proc.Tx, targets)
+		}
+	}
+
+	loaded := make(map[string]bool)
+	for _, key := range proc.Tx.CachedViews.Keys() {
+		loaded[key] = true
+	}
+
+	restoreOutput := replaceOutput(ctx, proc.Tx)
+	defer restoreOutput()
+
+	execCtx, cancel := limits.withTimeout(ctx)
+	defer cancel()
+
+	autoCommit := proc.Tx.AutoCommit
+	proc.Tx.AutoCommit = false
+	flow, err := executeWithShowResults(execCtx, proc, statements)
+	proc.Tx.AutoCommit = autoCommit
+
+	for _, key := range proc.Tx.CachedViews.Keys() {
+		if loaded[key] {
+			continue
+		}
+		if view, ok := proc.Tx.CachedViews.Load(key); ok {
+			stats.rowsScanned += view.RecordLen()
+			if view.FileInfo != nil && view.FileInfo.IsFile() {
+				stats.bytesRead += fileSize(view.FileInfo.Path)
+			}
+		}
+	}
+
+	if err = limits.timeoutError(ctx, execCtx, err); err == nil {
+		err = limits.check(proc.Tx, stats)
+	}
+	if errors.Is(err, ErrLimitExceeded) {
+		// Partial results are discarded.
+		proc.Tx.SelectedViews = nil
+		proc.Tx.AffectedRows = 0
+		if autoCommit {
+			_ = proc.AutoRollback()
+		}
+		return stats, err
+	}
+
+	if err == nil && conn != nil {
+		if err = conn.validateUncommittedTables(targets); err == nil {
+			err = conn.checkWritable()
+		}
+		if err != nil && autoCommit {
+			_ = proc.AutoRollback()
+			return stats, err
+		}
+	}
+
+	if err == nil && flow == query.Terminate && autoCommit {
+		err = commitTransaction(ctx, conn, proc, nil, stats)
+	}
+	if conn != nil {
+		// Tables can also be committed by COMMIT statements in the executed statements.
+		if syncErr := conn.syncFS(); err == nil {
+			err = syncErr
+		}
+	}
+	return stats, err
+}
+
+// commitTransaction commits the transaction and adds the sizes of the written files to the stats.
+// If expr is nil, the transaction is committed as an auto-commit.
+// If conn is not nil, the committed tables are written to the file system of the connection.
+func commitTransaction(ctx context.Context, conn *Conn, proc *query.Processor, expr parser.Expression, stats *executionStats) error {
+	files := uncommittedFiles(proc.Tx)
+
+	if conn != nil {
+		if err := conn.checkWritable(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if expr == nil {
+		err = proc.AutoCommit(ctx)
+	} else {
+		err = proc.Commit(ctx, expr)
+	}
+
+	if err == nil && stats != nil {
+		for _, f := range files {
+			stats.bytesWritten += fileSize(f)
+		}
+	}
+	if err == nil && conn != nil {
+		err = conn.syncFS()
+	}
+	return err
+}
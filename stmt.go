@@ -3,6 +3,7 @@ package csvq
 import (
 	"context"
 	"database/sql/driver"
+	"fmt"
 	"strconv"
 	"sync/atomic"
 
@@ -21,9 +22,23 @@ func GenerateStatementName() string {
 }
 
 type Stmt struct {
-	proc     *query.Processor
-	name     parser.Identifier
-	numInput int
+	proc        *query.Processor
+	name        parser.Identifier
+	numInput    int
+	queryString string
+	statements  []parser.Statement
+	// written holds the statements as written in the query string, which the policy of the connection checks.
+	written []parser.Statement
+	conn    *Conn
+	cached  *cachedStmt
+	// ordinals holds the ordinals of the arguments bound to the placeholders in order of appearance
+	// if the placeholders are rewritten from numbered placeholders.
+	ordinals []int
+	// variables is true if the statements refer to user variables.
+	// The number of inputs is not checked by database/sql because output parameters can be passed.
+	variables bool
+	// closed is true if the statement is closed, so that closing it again does not release the cached one twice.
+	closed bool
 }
 
 func NewStmt(ctx context.Context, proc *query.Processor, queryString string) (driver.Stmt, error) {
@@ -46,13 +61,42 @@ func NewStmt(ctx context.Context, proc *query.Processor, queryString string) (dr
 	}
 
 	return &Stmt{
-		proc:     proc,
-		name:     name,
-		numInput: stmt.HolderNumber,
+		proc:        proc,
+		name:        name,
+		numInput:    stmt.HolderNumber,
+		queryString: queryString,
+		statements:  stmt.Statements,
+		variables:   referencesVariables(stmt.Statements),
 	}, nil
 }
 
+func (stmt *Stmt) setOrdinals(ordinals []int) {
+	if ordinals == nil {
+		return
+	}
+	stmt.ordinals = ordinals
+	stmt.numInput = 0
+	for _, n := range ordinals {
+		if stmt.numInput < n {
+			stmt.numInput = n
+		}
+	}
+}
+
 func (stmt *Stmt) Close() error {
+	if stmt.closed {
+		return nil
+	}
+	stmt.closed = true
+
+	if stmt.cached != nil {
+		return stmt.conn.stmtCache.release(stmt.cached)
+	}
+	return stmt.dispose()
+}
+
+// dispose removes the prepared statement from the processor.
+func (stmt *Stmt) dispose() error {
 	statements := []parser.Statement{
 		parser.DisposeStatement{
 			Name: stmt.name,
@@ -63,6 +107,9 @@ func (stmt *Stmt) Close() error {
 }
 
 func (stmt *Stmt) NumInput() int {
+	if stmt.variables {
+		return -1
+	}
 	return stmt.numInput
 }
 
@@ -71,7 +118,7 @@ func (stmt *Stmt) Exec(args []driver.Value) (driver.Result, error) {
 }
 
 func (stmt *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	if err := stmt.exec(ctx, args); err != nil {
+	if err := stmt.exec(ctx, OperationExec, args); err != nil {
 		return nil, err
 	}
 	return NewResult(int64(stmt.proc.Tx.AffectedRows)), nil
@@ -82,10 +129,19 @@ func (stmt *Stmt) Query(args []driver.Value) (driver.Rows, error) {
 }
 
 func (stmt *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	if err := stmt.exec(ctx, args); err != nil {
+	if err := stmt.exec(contextForShowResults(ctx), OperationQuery, args); err != nil {
+		return nil, err
+	}
+	if stmt.conn == nil {
+		return NewRows(stmt.proc.Tx.SelectedViews), nil
+	}
+
+	rows := newTracedRows(ctx, stmt.conn.options, stmt.proc.Tx.SelectedViews)
+	if err := stmt.conn.applyTableSchemas(rows, stmt.statements); err != nil {
+		_ = rows.Close()
 		return nil, err
 	}
-	return NewRows(stmt.proc.Tx.SelectedViews), nil
+	return rows, nil
 }
 
 func (stmt *Stmt) valuesToNamedValues(values []driver.Value) []driver.NamedValue {
@@ -96,7 +152,49 @@ func (stmt *Stmt) valuesToNamedValues(values []driver.Value) []driver.NamedValue
 	return nvs
 }
 
-func (stmt *Stmt) exec(ctx context.Context, args []driver.NamedValue) error {
+func (stmt *Stmt) exec(ctx context.Context, operation string, args []driver.NamedValue) (err error) {
+	outs, args := splitOutArguments(args)
+	if err = bindOutArguments(stmt.proc, outs); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			err = readOutArguments(stmt.proc, outs)
+		}
+	}()
+
+	if stmt.conn == nil {
+		_, err = stmt.execute(ctx, args)
+		return err
+	}
+
+	var stats *executionStats
+	ctx, obs := startObservation(ctx, stmt.conn.options, operation, stmt.queryString, stmt.proc.Tx.Flags.Repository, args)
+	defer func() {
+		obs.finish(ctx, stmt.proc.Tx, stats, err)
+	}()
+	obs.setStatements(stmt.statements)
+
+	stats, err = stmt.execute(ctx, args)
+	return err
+}
+
+func (stmt *Stmt) execute(ctx context.Context, args []driver.NamedValue) (*executionStats, error) {
+	if stmt.variables && len(args) != stmt.numInput {
+		return nil, fmt.Errorf("expected %d arguments, got %d", stmt.numInput, len(args))
+	}
+
+	if stmt.ordinals != nil {
+		bound := make([]driver.NamedValue, 0, len(stmt.ordinals))
+		for _, n := range stmt.ordinals {
+			if len(args) < n {
+				return nil, fmt.Errorf("no argument for placeholder $%d", n)
+			}
+			bound = append(bound, args[n-1])
+		}
+		args = bound
+	}
+
 	values := make([]parser.ReplaceValue, 0, len(args))
 	for i := range args {
 		v, _ := stmt.ColumnConverter(i).ConvertValue(args[i].Value)
@@ -106,6 +204,14 @@ func (stmt *Stmt) exec(ctx context.Context, args []driver.NamedValue) error {
 		})
 	}
 
+	if stmt.conn != nil {
+		dispose, err := stmt.conn.declareVirtualTables(query.ContextForPreparedStatement(ctx, query.NewReplaceValues(values)), stmt.statements)
+		if err != nil {
+			return nil, err
+		}
+		defer dispose()
+	}
+
 	statements := []parser.Statement{
 		parser.ExecuteStatement{
 			Name:   stmt.name,
@@ -113,8 +219,7 @@ func (stmt *Stmt) exec(ctx context.Context, args []driver.NamedValue) error {
 		},
 	}
 
-	_, err := stmt.proc.Execute(query.ContextForStoringResults(ctx), statements)
-	return err
+	return executeStatements(query.ContextForStoringResults(ctx), stmt.conn, stmt.proc, statements)
 }
 
 func (stmt *Stmt) ColumnConverter(_ int) driver.ValueConverter {
@@ -122,6 +227,10 @@ func (stmt *Stmt) ColumnConverter(_ int) driver.ValueConverter {
 }
 
 func (stmt *Stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if ok, err := checkOutArgument(nv); ok {
+		return err
+	}
+
 	index := nv.Ordinal - 1
 	if _, err := stmt.ColumnConverter(index).ConvertValue(nv.Value); err != nil {
 		return err
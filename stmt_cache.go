@@ -0,0 +1,115 @@
+package csvq
+
+import (
+	"container/list"
+)
+
+// DefaultStmtCacheSize is the number of prepared statements cached by a connection by default.
+const DefaultStmtCacheSize = 32
+
+type stmtCacheKey struct {
+	queryString string
+	repository  string
+	ansiQuotes  bool
+	// variables is the names of the variables declared in the connection in the placeholder dialect "at".
+	variables string
+}
+
+type cachedStmt struct {
+	key  stmtCacheKey
+	stmt *Stmt
+	// refs is the number of statements returned from the cache and not closed yet.
+	refs int
+	// evicted is true if the statement is removed from the cache while it is in use.
+	// The statement is disposed when all the statements returned from the cache are closed.
+	evicted bool
+}
+
+// stmtCache is an LRU cache of the prepared statements of a connection keyed by the query strings,
+// so that statements prepared repeatedly are not parsed again.
+type stmtCache struct {
+	size    int
+	entries map[stmtCacheKey]*list.Element
+	lru     *list.List
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:    size,
+		entries: make(map[stmtCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get returns a copy of the cached statement. The returned statement must be closed to release the cached one.
+func (c *stmtCache) get(key stmtCacheKey) (*Stmt, bool) {
+	if c == nil || c.size < 1 {
+		return nil, false
+	}
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return c.acquire(elem.Value.(*cachedStmt)), true
+}
+
+// put caches the statement and returns the statement that refers to the cached one.
+// If the cache is full, the least recently used statement is removed.
+func (c *stmtCache) put(key stmtCacheKey, stmt *Stmt) *Stmt {
+	if c == nil || c.size < 1 {
+		return stmt
+	}
+	if _, ok := c.entries[key]; ok {
+		return stmt
+	}
+
+	entry := &cachedStmt{key: key, stmt: stmt}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.size < c.lru.Len() {
+		c.remove(c.lru.Back())
+	}
+	return c.acquire(entry)
+}
+
+func (c *stmtCache) acquire(entry *cachedStmt) *Stmt {
+	entry.refs++
+	stmt := *entry.stmt
+	stmt.cached = entry
+	return &stmt
+}
+
+// release is called when a statement returned from the cache is closed.
+func (c *stmtCache) release(entry *cachedStmt) error {
+	entry.refs--
+	if entry.evicted && entry.refs < 1 {
+		return entry.stmt.dispose()
+	}
+	return nil
+}
+
+func (c *stmtCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cachedStmt)
+	delete(c.entries, entry.key)
+	entry.evicted = true
+	if entry.refs < 1 {
+		_ = entry.stmt.dispose()
+	}
+}
+
+// clear removes all the statements from the cache.
+func (c *stmtCache) clear() {
+	if c == nil {
+		return
+	}
+	for 0 < c.lru.Len() {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *stmtCache) len() int {
+	if c == nil {
+		return 0
+	}
+	return c.lru.Len()
+}
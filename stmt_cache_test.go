@@ -0,0 +1,110 @@
+package csvq
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/file"
+)
+
+func TestStmtCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	options := newConnectorOptions()
+	WithStmtCacheSize(2)(options)
+	c, err := newConn(ctx, TestDir, file.DefaultWaitTimeout, file.DefaultRetryDelay, options)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	prepare := func(queryString string) *Stmt {
+		s, err := c.PrepareContext(ctx, queryString)
+		if err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		return s.(*Stmt)
+	}
+	isPrepared := func(stmt *Stmt) bool {
+		_, err := c.proc.Tx.PreparedStatements.Get(stmt.name)
+		return err == nil
+	}
+
+	q1 := "SELECT col2 FROM `table_q.csv` WHERE col1 = ?"
+	stmt1 := prepare(q1)
+	stmt2 := prepare(q1)
+	if stmt1.name != stmt2.name {
+		t.Errorf("statement %s is prepared again, want the cached statement %s", stmt2.name, stmt1.name)
+	}
+	_ = stmt2.Close()
+	_ = stmt2.Close()
+	if stmt1.cached.refs != 1 {
+		t.Errorf("references = %d, want %d after a statement is closed twice", stmt1.cached.refs, 1)
+	}
+	if !isPrepared(stmt1) {
+		t.Fatal("statement in use is disposed")
+	}
+
+	stmt3 := prepare("SELECT 2 WHERE 1 = ?")
+	_ = stmt3.Close()
+	stmt4 := prepare("SELECT 3 WHERE 1 = ?")
+	_ = stmt4.Close()
+	if c.stmtCache.len() != 2 {
+		t.Errorf("cache length = %d, want %d", c.stmtCache.len(), 2)
+	}
+	if !isPrepared(stmt1) {
+		t.Fatal("evicted statement in use is disposed")
+	}
+	if !isPrepared(stmt3) || !isPrepared(stmt4) {
+		t.Error("cached statements are disposed")
+	}
+
+	rows, err := stmt1.QueryContext(ctx, []driver.NamedValue{{Ordinal: 1, Value: 2}})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	_ = rows.Close()
+	_ = stmt1.Close()
+	if isPrepared(stmt1) {
+		t.Error("evicted statement is not disposed when it is closed")
+	}
+
+	if err = c.ResetSession(ctx); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if c.stmtCache.len() != 0 {
+		t.Errorf("cache length = %d, want %d after the session is reset", c.stmtCache.len(), 0)
+	}
+	if isPrepared(stmt3) || isPrepared(stmt4) {
+		t.Error("cached statements are not disposed when the session is reset")
+	}
+	if stmt := prepare(q1); stmt.name == stmt1.name {
+		t.Error("statement is not prepared again after the session is reset")
+	}
+}
+
+func TestStmtCache_Disabled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	c, err := NewConn(ctx, TestDir+"?StmtCacheSize=0", waitTimeoutForTests, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	stmt1, _ := c.PrepareContext(ctx, "SELECT 1")
+	stmt2, _ := c.PrepareContext(ctx, "SELECT 1")
+	if stmt1.(*Stmt).name == stmt2.(*Stmt).name {
+		t.Error("statement is cached, want not cached")
+	}
+	_ = stmt1.Close()
+	_ = stmt2.Close()
+}
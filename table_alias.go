@@ -0,0 +1,222 @@
+package csvq
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	txjson "github.com/mithrandie/go-text/json"
+)
+
+// TableAlias maps a logical table name to a file and the options to read it.
+// Queries refer to the file by the logical name, such as "SELECT * FROM users".
+type TableAlias struct {
+	// Path is the path of the file. A relative path is resolved from the repository.
+	Path string `json:"path"`
+
+	// Format is one of CSV, TSV, FIXED, JSON, JSONL and LTSV.
+	// If empty, the format is determined by the extension of the file.
+	Format string `json:"format"`
+
+	// Delimiter is the delimiter of CSV, or the delimiter positions of FIXED such as "[3, 8]" and "SPACES".
+	Delimiter string `json:"delimiter"`
+
+	// Encoding is the character encoding of the file, such as UTF8 and SJIS.
+	// If empty, the encoding of the connection is used.
+	Encoding string `json:"encoding"`
+
+	// NoHeader is true if the first line of the file is not a header.
+	NoHeader bool `json:"no_header"`
+}
+
+// readTableAliasFile reads the table aliases from a JSON file that maps logical table names to TableAlias objects.
+// If fsys is not nil, relative paths are read from the file system.
+func readTableAliasFile(fsys fs.FS, path string) (map[string]TableAlias, error) {
+	var b []byte
+	var err error
+	if fsys != nil && !filepath.IsAbs(path) {
+		b, err = fs.ReadFile(fsys, filepath.ToSlash(path))
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table alias file %s: %w", path, err)
+	}
+
+	aliases := make(map[string]TableAlias)
+	if err = json.Unmarshal(b, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to read table alias file %s: %w", path, err)
+	}
+	return aliases, nil
+}
+
+// tableAliases returns the table aliases passed by WithTableAlias and WithTableAliasFile keyed by the upper-cased names.
+// Aliases passed by WithTableAlias take precedence over the aliases in the files.
+func tableAliases(options *connectorOptions) (map[string]TableAlias, error) {
+	aliases := make(map[string]TableAlias)
+	add := func(name string, alias TableAlias) error {
+		if err := alias.validate(); err != nil {
+			return fmt.Errorf("invalid table alias %s: %w", name, err)
+		}
+		aliases[strings.ToUpper(name)] = alias
+		return nil
+	}
+
+	for _, path := range options.tableAliasFiles {
+		m, err := readTableAliasFile(options.fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		for name, alias := range m {
+			if err = add(name, alias); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name, alias := range options.tableAliases {
+		if err := add(name, alias); err != nil {
+			return nil, err
+		}
+	}
+	if len(aliases) < 1 {
+		return nil, nil
+	}
+	return aliases, nil
+}
+
+func (a TableAlias) format() (option.Format, error) {
+	if len(a.Format) < 1 {
+		switch strings.ToLower(filepath.Ext(a.Path)) {
+		case option.TsvExt:
+			return option.TSV, nil
+		case option.JsonExt:
+			return option.JSON, nil
+		case option.JsonlExt:
+			return option.JSONL, nil
+		case option.LtsvExt:
+			return option.LTSV, nil
+		}
+		return option.CSV, nil
+	}
+
+	f, _, err := option.ParseFormat(a.Format, txjson.Backslash)
+	if err != nil {
+		return f, err
+	}
+	switch f {
+	case option.CSV, option.TSV, option.FIXED, option.JSON, option.JSONL, option.LTSV:
+		return f, nil
+	}
+	return f, fmt.Errorf("format %s cannot be read", a.Format)
+}
+
+func (a TableAlias) validate() error {
+	if len(a.Path) < 1 {
+		return fmt.Errorf("path is empty")
+	}
+	f, err := a.format()
+	if err != nil {
+		return err
+	}
+	switch f {
+	case option.CSV:
+		if 0 < len(a.Delimiter) && len([]rune(a.Delimiter)) != 1 {
+			return fmt.Errorf("delimiter must be one character")
+		}
+	case option.FIXED:
+		if _, _, err = option.ParseDelimiterPositions(a.Delimiter); err != nil {
+			return err
+		}
+	}
+	if 0 < len(a.Encoding) {
+		if _, err = option.ParseEncoding(a.Encoding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableObject returns the table object of csvq that reads the file with the options of the alias.
+func (a TableAlias) tableObject() string {
+	path := option.QuoteIdentifier(a.Path)
+
+	encoding := "NULL"
+	if 0 < len(a.Encoding) {
+		encoding = option.QuoteString(a.Encoding)
+	}
+	noHeader := strings.ToUpper(strconv.FormatBool(a.NoHeader))
+
+	f, _ := a.format()
+	switch f {
+	case option.TSV:
+		return fmt.Sprintf("CSV('\\t', %s, %s, %s)", path, encoding, noHeader)
+	case option.FIXED:
+		delimiter := a.Delimiter
+		if len(delimiter) < 1 {
+			delimiter = option.DelimitAutomatically
+		}
+		return fmt.Sprintf("FIXED(%s, %s, %s, %s)", option.QuoteString(delimiter), path, encoding, noHeader)
+	case option.JSON:
+		return fmt.Sprintf("JSON('', %s)", path)
+	case option.JSONL:
+		return fmt.Sprintf("JSONL('', %s)", path)
+	case option.LTSV:
+		return fmt.Sprintf("LTSV(%s, %s)", path, encoding)
+	}
+
+	delimiter := a.Delimiter
+	if len(delimiter) < 1 {
+		delimiter = ","
+	}
+	return fmt.Sprintf("CSV(%s, %s, %s, %s)", option.QuoteString(delimiter), path, encoding, noHeader)
+}
+
+// tableAlias returns the alias of the table name if the name is a logical table name.
+func (c *Conn) tableAlias(name string) (TableAlias, bool) {
+	alias, ok := c.tableAliases[strings.ToUpper(name)]
+	return alias, ok
+}
+
+// rewriteTableAliases replaces the logical table names in the query string with the table objects of the files.
+// Tables in FROM clauses are given the logical names as their aliases so that columns can be qualified by them.
+func (c *Conn) rewriteTableAliases(queryString string) string {
+	if len(c.tableAliases) < 1 {
+		return queryString
+	}
+
+	ansiQuotes := c.proc.Tx.Flags.AnsiQuotes
+	statements, _, err := parser.Parse(queryString, "", true, ansiQuotes)
+	if err != nil {
+		// Syntax errors are reported when the query string is parsed again.
+		return queryString
+	}
+	positions := c.tablePositions(statements, func(name string) bool {
+		_, ok := c.tableAlias(name)
+		return ok
+	}, false)
+	if len(positions) < 1 {
+		return queryString
+	}
+
+	tokens := tokenizeQuery(queryString, ansiQuotes)
+	forEachTablePosition(tokens, positions, func(i int, canBeAliased bool) {
+		t := tokens[i]
+		name := t.literal
+		if t.typ == tokenIdentifier {
+			name = unquoteIdentifier(t.literal)
+		}
+		if alias, ok := c.tableAlias(name); ok && (t.typ == tokenWord || t.typ == tokenIdentifier) {
+			tokens[i].literal = alias.tableObject()
+			if canBeAliased {
+				tokens[i].literal += " AS " + option.QuoteIdentifier(name)
+			}
+		}
+	})
+	return joinQueryTokens(tokens)
+}
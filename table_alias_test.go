@@ -0,0 +1,142 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupTableAliasDir(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"users.txt":   "id;name\n1;str1\n2;str2\n",
+		"numbers.tsv": "1\tone\n2\ttwo\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, "data", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aliases := `{"numbers": {"path": "data/numbers.tsv", "no_header": true}}`
+	if err := os.WriteFile(filepath.Join(dir, "aliases.json"), []byte(aliases), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestWithTableAlias(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := setupTableAliasDir(t)
+	db := sql.OpenDB(NewConnector(dir,
+		WithTableAlias("users", TableAlias{Path: "data/users.txt", Format: "CSV", Delimiter: ";"}),
+		WithTableAliasFile(filepath.Join(dir, "aliases.json")),
+	))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	queries := []struct {
+		Query  string
+		Expect [][]interface{}
+	}{
+		{
+			Query:  "SELECT users.id, name FROM users",
+			Expect: [][]interface{}{{1, "str1"}, {2, "str2"}},
+		},
+		{
+			Query:  "SELECT u.id, numbers.c2 FROM Users u JOIN numbers ON u.id = numbers.c1",
+			Expect: [][]interface{}{{1, "one"}, {2, "two"}},
+		},
+		{
+			Query:  "WITH users AS (SELECT 3 AS id, 'str3' AS name) SELECT * FROM users",
+			Expect: [][]interface{}{{3, "str3"}},
+		},
+	}
+	for _, v := range queries {
+		if err := matchRows(ctx, db, v.Expect, v.Query); err != nil {
+			t.Errorf("%s: %s", v.Query, err)
+		}
+	}
+
+	statements := []string{
+		"INSERT INTO users (id, name) VALUES (3, 'str3')",
+		"UPDATE users SET name = 'updated' WHERE id = 1",
+		"DELETE u FROM users u WHERE id = 2",
+	}
+	for _, s := range statements {
+		if _, err := db.ExecContext(ctx, s); err != nil {
+			t.Fatalf("%s: unexpected error %q", s, err.Error())
+		}
+	}
+	if err := matchRows(ctx, db, [][]interface{}{{3, "str3"}}, "SELECT * FROM users WHERE id = ?", 3); err != nil {
+		t.Error(err)
+	}
+	if err := matchRows(ctx, db, [][]interface{}{{1, "updated"}, {3, "str3"}}, "SELECT * FROM users"); err != nil {
+		t.Error(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "data", "users.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "id;name\n1;updated\n3;str3\n"; string(b) != expect {
+		t.Errorf("file content = %q, want %q", string(b), expect)
+	}
+}
+
+func TestWithTableAlias_Invalid(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := setupTableAliasDir(t)
+	tests := []struct {
+		Name    string
+		Options []ConnectorOption
+		Error   string
+	}{
+		{
+			Name:    "Empty Path",
+			Options: []ConnectorOption{WithTableAlias("users", TableAlias{})},
+			Error:   "invalid table alias users: path is empty",
+		},
+		{
+			Name:    "Invalid Format",
+			Options: []ConnectorOption{WithTableAlias("users", TableAlias{Path: "data/users.txt", Format: "GFM"})},
+			Error:   "invalid table alias users: format GFM cannot be read",
+		},
+		{
+			Name:    "Invalid Delimiter",
+			Options: []ConnectorOption{WithTableAlias("users", TableAlias{Path: "data/users.txt", Delimiter: ";;"})},
+			Error:   "invalid table alias users: delimiter must be one character",
+		},
+		{
+			Name:    "File Not Exist",
+			Options: []ConnectorOption{WithTableAliasFile(filepath.Join(dir, "notexist.json"))},
+			Error:   "failed to read table alias file " + filepath.Join(dir, "notexist.json") + ": open " + filepath.Join(dir, "notexist.json") + ": no such file or directory",
+		},
+	}
+
+	for _, v := range tests {
+		t.Run(v.Name, func(t *testing.T) {
+			db := sql.OpenDB(NewConnector(dir, v.Options...))
+			defer func() {
+				_ = db.Close()
+			}()
+
+			err := db.PingContext(ctx)
+			if err == nil {
+				t.Fatal("no error, want error")
+			}
+			if err.Error() != v.Error {
+				t.Errorf("error = %q, want error %q", err.Error(), v.Error)
+			}
+		})
+	}
+}
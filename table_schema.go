@@ -0,0 +1,294 @@
+package csvq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mithrandie/csvq/lib/option"
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+	"github.com/mithrandie/csvq/lib/value"
+)
+
+// SchemaFileSuffix is the suffix of schema files placed next to table files.
+// The schema of "users.csv" is read from "users.csv.schema.json".
+const SchemaFileSuffix = ".schema.json"
+
+var errNullValue = errors.New("value must not be null")
+
+// TableSchema declares the types of the columns in a table.
+// Columns that are not declared are returned as they are read by csvq.
+type TableSchema struct {
+	Columns []ColumnSchema `json:"columns"`
+}
+
+type ColumnSchema struct {
+	Name string `json:"name"`
+
+	// Type is one of STRING, INTEGER, FLOAT, BOOLEAN and DATETIME.
+	Type string `json:"type"`
+
+	NotNull bool `json:"not_null"`
+
+	// DatetimeFormat is the format of DATETIME values, such as "%Y-%m-%d".
+	// If empty, the datetime formats of the connection are used.
+	DatetimeFormat string `json:"datetime_format"`
+}
+
+type SchemaError struct {
+	Table  string
+	Column string
+	Record int
+	Value  string
+	Err    error
+}
+
+func NewSchemaError(table string, column string, record int, val string, err error) error {
+	return &SchemaError{
+		Table:  table,
+		Column: column,
+		Record: record,
+		Value:  val,
+		Err:    err,
+	}
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("schema of table %s: column %s in record %d: %s", e.Table, e.Column, e.Record, e.Err.Error())
+}
+
+func (e SchemaError) Unwrap() error {
+	return e.Err
+}
+
+func (s TableSchema) validate() error {
+	for _, col := range s.Columns {
+		if len(col.Name) < 1 {
+			return errors.New("column name is empty")
+		}
+		switch strings.ToUpper(col.Type) {
+		case TypeString, TypeInteger, TypeFloat, TypeBoolean, TypeDatetime:
+		default:
+			return fmt.Errorf("type %q of column %s is invalid", col.Type, col.Name)
+		}
+	}
+	return nil
+}
+
+func (s TableSchema) column(name string) *ColumnSchema {
+	for i := range s.Columns {
+		if strings.EqualFold(s.Columns[i].Name, name) {
+			return &s.Columns[i]
+		}
+	}
+	return nil
+}
+
+func (col *ColumnSchema) convert(p value.Primary, flags *option.Flags) (value.Primary, error) {
+	if value.IsNull(p) {
+		if col.NotNull {
+			return nil, errNullValue
+		}
+		return p, nil
+	}
+	if s, ok := p.(*value.String); ok && len(strings.TrimSpace(s.Raw())) < 1 && !strings.EqualFold(col.Type, TypeString) {
+		if col.NotNull {
+			return nil, errNullValue
+		}
+		return value.NewNull(), nil
+	}
+
+	var converted value.Primary
+	switch strings.ToUpper(col.Type) {
+	case TypeInteger:
+		converted = value.ToIntegerStrictly(p)
+	case TypeFloat:
+		converted = value.ToFloat(p)
+	case TypeBoolean:
+		converted = value.ToBoolean(p)
+	case TypeDatetime:
+		formats := flags.DatetimeFormat
+		if 0 < len(col.DatetimeFormat) {
+			formats = []string{col.DatetimeFormat}
+		}
+		converted = value.ToDatetime(p, formats, flags.GetTimeLocation())
+	default:
+		converted = value.ToString(p)
+	}
+
+	if value.IsNull(converted) {
+		return nil, fmt.Errorf("cannot convert %s to %s", p.String(), strings.ToUpper(col.Type))
+	}
+	return converted, nil
+}
+
+func readSchemaFile(path string) (*TableSchema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	schema := &TableSchema{}
+	if err = json.Unmarshal(b, schema); err != nil {
+		return nil, fmt.Errorf("failed to read schema file %s: %w", path, err)
+	}
+	if err = schema.validate(); err != nil {
+		return nil, fmt.Errorf("failed to read schema file %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// tableSchema returns the schema of the table file. Schemas registered by WithTableSchema take precedence over schema files.
+// Tables of the schemas can also be specified by the logical names of the table aliases.
+func (c *Conn) tableSchema(path string) (*TableSchema, error) {
+	repository, err := repositoryPath(c.proc.Tx.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, schema := range c.options.tableSchemas {
+		if alias, ok := c.tableAlias(name); ok {
+			name = alias.Path
+		}
+		p, err := query.SearchFilePathFromAllTypes(parser.Identifier{Literal: name}, repository)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(p, path) {
+			s := schema
+			return &s, nil
+		}
+	}
+	return readSchemaFile(path + SchemaFileSuffix)
+}
+
+// viewSchemas returns the schemas of the tables referred by the statements, keyed by the upper-cased view names
+// that the tables are referred as in the headers of the results.
+func (c *Conn) viewSchemas(statements []parser.Statement) (map[string]*TableSchema, error) {
+	repository, err := repositoryPath(c.proc.Tx.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas := make(map[string]*TableSchema)
+
+	var schemaErr error
+	walkStatements(statements, func(node interface{}) bool {
+		table, ok := node.(parser.Table)
+		if !ok || schemaErr != nil {
+			return schemaErr == nil
+		}
+
+		name, ok := tableObjectName(table.Object)
+		if !ok || c.proc.ReferenceScope.TemporaryTableExists(name) {
+			return true
+		}
+		path, err := query.SearchFilePathFromAllTypes(parser.Identifier{Literal: name}, repository)
+		if err != nil {
+			return true
+		}
+
+		schema, err := c.tableSchema(path)
+		if err != nil {
+			schemaErr = err
+			return false
+		}
+		if schema == nil {
+			return true
+		}
+
+		viewName := query.FormatTableName(name)
+		if alias, ok := table.Alias.(parser.Identifier); ok {
+			viewName = alias.Literal
+		}
+		schemas[strings.ToUpper(viewName)] = schema
+		return true
+	})
+	return schemas, schemaErr
+}
+
+// applyTableSchemas sets the declared column schemas to the result sets.
+// Schema files are looked up next to the files of the tables, so tables in subdirectories can also have schema files.
+func (c *Conn) applyTableSchemas(rows *Rows, statements []parser.Statement) error {
+	schemas, err := c.viewSchemas(statements)
+	if err != nil || len(schemas) < 1 {
+		return err
+	}
+
+	for _, set := range rows.resultSets {
+		set.setSchemas(schemas, c.proc.Tx.Flags)
+	}
+	return nil
+}
+
+func modifiesTables(statements []parser.Statement) bool {
+	modifies := false
+	walkStatements(statements, func(node interface{}) bool {
+		switch node.(type) {
+		case parser.InsertQuery, parser.UpdateQuery, parser.ReplaceQuery:
+			modifies = true
+		}
+		return !modifies
+	})
+	return modifies
+}
+
+// validateUncommittedTables validates the records of the created or updated tables against their schemas.
+func (c *Conn) validateUncommittedTables(statements []parser.Statement) error {
+	if !modifiesTables(statements) {
+		return nil
+	}
+
+	createdFiles, updatedFiles := c.proc.Tx.UncommittedViews.UncommittedFiles()
+	files := make([]*query.FileInfo, 0, len(createdFiles)+len(updatedFiles))
+	for _, f := range createdFiles {
+		files = append(files, f)
+	}
+	for _, f := range updatedFiles {
+		files = append(files, f)
+	}
+
+	for _, f := range files {
+		schema, err := c.tableSchema(f.Path)
+		if err != nil {
+			return err
+		}
+		if schema == nil {
+			continue
+		}
+
+		view, ok := c.proc.Tx.CachedViews.Load(f.IdentifiedPath())
+		if !ok {
+			continue
+		}
+		if err := validateView(view, filepath.Base(f.Path), schema, c.proc.Tx.Flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateView(view *query.View, table string, schema *TableSchema, flags *option.Flags) error {
+	columns := view.Header.TableColumnNames()
+	for i, name := range columns {
+		col := schema.column(name)
+		if col == nil {
+			continue
+		}
+
+		for j := 0; j < view.RecordLen(); j++ {
+			p := view.RecordSet[j][i][0]
+			if _, err := col.convert(p, flags); err != nil {
+				return NewSchemaError(table, name, j+1, p.String(), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTableSchema_Query(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", TableSchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rs, err := db.QueryContext(ctx, "SELECT t.id, price, active, created, name, UPPER(name) AS upper_name FROM `typed.csv` t")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = rs.Close()
+	}()
+
+	var records [][]interface{}
+	for rs.Next() {
+		var (
+			id        int64
+			price     sql.NullFloat64
+			active    bool
+			created   sql.NullTime
+			name      sql.NullString
+			upperName sql.NullString
+		)
+		if err := rs.Scan(&id, &price, &active, &created, &name, &upperName); err != nil {
+			t.Fatalf("unexpected error %q", err.Error())
+		}
+		records = append(records, []interface{}{id, price, active, created, name, upperName})
+	}
+	if err := rs.Err(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	date := func(day int) sql.NullTime {
+		return sql.NullTime{Time: time.Date(2026, 1, day, 0, 0, 0, 0, time.Local), Valid: true}
+	}
+	str := func(s string) sql.NullString {
+		return sql.NullString{String: s, Valid: true}
+	}
+	expect := [][]interface{}{
+		{int64(1), sql.NullFloat64{Float64: 1.5, Valid: true}, true, date(2), str("apple"), str("APPLE")},
+		{int64(2), sql.NullFloat64{Float64: 2, Valid: true}, false, date(3), sql.NullString{}, sql.NullString{}},
+		{int64(3), sql.NullFloat64{}, true, sql.NullTime{}, str("banana"), str("BANANA")},
+	}
+	if !reflect.DeepEqual(records, expect) {
+		t.Fatalf("records = %v, want %v", records, expect)
+	}
+}
+
+func TestTableSchema_Registered(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TableSchemaTestDir, WithTableSchema("table", TableSchema{
+		Columns: []ColumnSchema{
+			{Name: "col1", Type: TypeBoolean},
+		},
+	})))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var col1 bool
+	if err := db.QueryRowContext(ctx, "SELECT col1 FROM `table.csv` WHERE col2 = 'str1'").Scan(&col1); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if !col1 {
+		t.Fatalf("col1 = %t, want %t", col1, true)
+	}
+
+	rs, err := db.QueryContext(ctx, "SELECT col1 FROM `table.csv`")
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	for rs.Next() {
+	}
+	_ = rs.Close()
+
+	var schemaErr *SchemaError
+	if err := rs.Err(); !errors.As(err, &schemaErr) {
+		t.Fatalf("error = %v, want a SchemaError", err)
+	}
+	if schemaErr.Column != "col1" || schemaErr.Record != 2 || schemaErr.Value != "'2'" {
+		t.Fatalf("error = %+v, unexpected error attributes", schemaErr)
+	}
+}
+
+func TestTableSchema_InvalidRegistration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db := sql.OpenDB(NewConnector(TableSchemaTestDir, WithTableSchema("table", TableSchema{
+		Columns: []ColumnSchema{
+			{Name: "col1", Type: "X"},
+		},
+	})))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	expect := "invalid table schema table: type \"X\" of column col1 is invalid"
+	if err := db.PingContext(ctx); err == nil || err.Error() != expect {
+		t.Fatalf("error = %v, want %q", err, expect)
+	}
+}
+
+func TestTableSchema_Validation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	db, _ := sql.Open("csvq", TableSchemaTestDir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	_, err := db.ExecContext(ctx, "INSERT INTO `typed.csv` (id, active) VALUES ('abc', true)")
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("error = %v, want a SchemaError", err)
+	}
+	expect := "schema of table typed.csv: column id in record 4: cannot convert 'abc' to INTEGER"
+	if err.Error() != expect {
+		t.Fatalf("error = %q, want %q", err.Error(), expect)
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE `typed.csv` SET active = NULL WHERE id = 1")
+	if !errors.As(err, &schemaErr) || !errors.Is(err, errNullValue) {
+		t.Fatalf("error = %v, want a SchemaError for a null value", err)
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM `typed.csv` WHERE active IS NOT NULL").Scan(&count); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if count != 3 {
+		t.Fatalf("count = %d, want %d", count, 3)
+	}
+}
+
+func TestTableSchema_Subdirectory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "t.csv"), []byte("id,active\n1,true\n"), 0644); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "t.csv"+SchemaFileSuffix), []byte(`{"columns": [{"name": "active", "type": "BOOLEAN"}]}`), 0644); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	db, _ := sql.Open("csvq", dir)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var active interface{}
+	if err := db.QueryRowContext(ctx, "SELECT active FROM `sub/t.csv`").Scan(&active); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if active != true {
+		t.Fatalf("active = %#v, want %#v", active, true)
+	}
+}
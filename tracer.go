@@ -0,0 +1,68 @@
+package csvq
+
+import (
+	"context"
+
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+const (
+	OperationConnect = "connect"
+	OperationPrepare = "prepare"
+	OperationRows    = "rows"
+)
+
+const (
+	AttributeStatement    = "db.statement"
+	AttributeRepository   = "csvq.repository"
+	AttributeFiles        = "csvq.files"
+	AttributeRowsReturned = "csvq.rows_returned"
+	AttributeRowsAffected = "csvq.rows_affected"
+	AttributeCached       = "csvq.cached"
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts a span around each operation of the driver.
+// The returned context is passed to the operations executed inside the span.
+type Tracer interface {
+	Start(ctx context.Context, operation string, attrs ...Attribute) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	End(err error)
+}
+
+type noopTracer struct{}
+
+func (t noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (s noopSpan) SetAttributes(_ ...Attribute) {}
+
+func (s noopSpan) End(_ error) {}
+
+func startSpan(ctx context.Context, options *connectorOptions, operation string, attrs ...Attribute) (context.Context, Span) {
+	if options == nil || options.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return options.tracer.Start(ctx, operation, attrs...)
+}
+
+func resultAttributes(tx *query.Transaction) []Attribute {
+	rows := 0
+	for _, view := range tx.SelectedViews {
+		rows += view.RecordLen()
+	}
+	return []Attribute{
+		{Key: AttributeRowsReturned, Value: rows},
+		{Key: AttributeRowsAffected, Value: tx.AffectedRows},
+	}
+}
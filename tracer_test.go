@@ -0,0 +1,143 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type testSpan struct {
+	operation  string
+	attributes map[string]interface{}
+	parent     *testSpan
+	ended      bool
+	err        error
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type testSpanContextKey struct{}
+
+type testTracer struct {
+	mtx   sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, operation string, attrs ...Attribute) (context.Context, Span) {
+	span := &testSpan{
+		operation:  operation,
+		attributes: make(map[string]interface{}),
+	}
+	if parent, ok := ctx.Value(testSpanContextKey{}).(*testSpan); ok {
+		span.parent = parent
+	}
+	span.SetAttributes(attrs...)
+
+	t.mtx.Lock()
+	t.spans = append(t.spans, span)
+	t.mtx.Unlock()
+
+	return context.WithValue(ctx, testSpanContextKey{}, span), span
+}
+
+func (t *testTracer) operations() []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	list := make([]string, 0, len(t.spans))
+	for _, s := range t.spans {
+		list = append(list, s.operation)
+	}
+	return list
+}
+
+func (t *testTracer) find(operation string) *testSpan {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for i := len(t.spans) - 1; 0 <= i; i-- {
+		if t.spans[i].operation == operation {
+			return t.spans[i]
+		}
+	}
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	tracer := &testTracer{}
+	db := sql.OpenDB(NewConnector(TestDir, WithTracer(tracer)))
+	defer func() {
+		_ = db.Close()
+	}()
+
+	queryString := "SELECT INTEGER(col1) AS col1, col2 FROM `table_trace.csv` WHERE col1 < ?"
+	err := matchRows(ctx, db, [][]interface{}{{1, "str1"}, {2, "str2"}}, queryString, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectOperations := []string{OperationConnect, OperationQuery, OperationPrepare, OperationRows}
+	if ops := tracer.operations(); !reflect.DeepEqual(ops, expectOperations) {
+		t.Fatalf("operations = %v, want %v", ops, expectOperations)
+	}
+
+	querySpan := tracer.find(OperationQuery)
+	if !querySpan.ended || querySpan.err != nil {
+		t.Fatalf("query span is not ended successfully")
+	}
+	if querySpan.attributes[AttributeStatement] != queryString {
+		t.Fatalf("statement = %v, want %q", querySpan.attributes[AttributeStatement], queryString)
+	}
+	if querySpan.attributes[AttributeRepository] != TestDir {
+		t.Fatalf("repository = %v, want %q", querySpan.attributes[AttributeRepository], TestDir)
+	}
+	if files := querySpan.attributes[AttributeFiles]; !reflect.DeepEqual(files, []string{"table_trace.csv"}) {
+		t.Fatalf("files = %v, want %v", files, []string{"table_trace.csv"})
+	}
+	if tracer.find(OperationPrepare).parent != querySpan {
+		t.Fatal("prepare span is not a child of the query span")
+	}
+
+	rowsSpan := tracer.find(OperationRows)
+	if !rowsSpan.ended || rowsSpan.attributes[AttributeRowsReturned] != 2 {
+		t.Fatalf("rows span = %v, want ended span with 2 rows", rowsSpan.attributes)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE `table_trace.csv` SET col2 = 'updated' WHERE col1 = 1"); err != nil {
+		_ = tx.Rollback()
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	execSpan := tracer.find(OperationExec)
+	if execSpan.attributes[AttributeRowsAffected] != 1 {
+		t.Fatalf("rows affected = %v, want %d", execSpan.attributes[AttributeRowsAffected], 1)
+	}
+	rollbackSpan := tracer.find(OperationRollback)
+	if rollbackSpan == nil || !rollbackSpan.ended {
+		t.Fatal("rollback span is not ended")
+	}
+	if files, ok := rollbackSpan.attributes[AttributeFiles].([]string); !ok || len(files) != 1 {
+		t.Fatalf("files = %v, want 1 file", rollbackSpan.attributes[AttributeFiles])
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 type Tx struct {
 	proc *query.Processor
+	conn *Conn
+	ctx  context.Context
 }
 
 func NewTx(proc *query.Processor) (driver.Tx, error) {
@@ -22,19 +24,55 @@ func NewTx(proc *query.Processor) (driver.Tx, error) {
 }
 
 func (tx Tx) Commit() error {
+	ctx := context.Background()
+	obs := tx.startObservation(OperationCommit)
+
+	stats := &executionStats{}
 	expr := parser.TransactionControl{Token: parser.COMMIT}
-	err := tx.proc.Commit(context.Background(), expr)
+	err := commitTransaction(ctx, tx.conn, tx.proc, expr, stats)
 	if err == nil {
 		tx.proc.Tx.AutoCommit = true
 	}
+
+	obs.finish(ctx, nil, stats, err)
 	return err
 }
 
 func (tx Tx) Rollback() error {
+	ctx := context.Background()
+	obs := tx.startObservation(OperationRollback)
+
 	expr := parser.TransactionControl{Token: parser.ROLLBACK}
 	err := tx.proc.Rollback(expr)
 	if err == nil {
 		tx.proc.Tx.AutoCommit = true
 	}
+
+	obs.finish(ctx, nil, nil, err)
 	return err
 }
+
+func (tx Tx) startObservation(operation string) *observation {
+	if tx.conn == nil {
+		return &observation{span: noopSpan{}}
+	}
+
+	ctx := tx.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	files := uncommittedFiles(tx.proc.Tx)
+
+	obs := &observation{
+		log:     newLogRecorder(tx.conn.options, operation, "", nil),
+		metrics: newMetricsRecorder(tx.conn.options, operation),
+	}
+	if obs.log != nil {
+		obs.log.entry.Files = files
+	}
+	_, obs.span = startSpan(ctx, tx.conn.options, operation,
+		Attribute{Key: AttributeRepository, Value: tx.proc.Tx.Flags.Repository},
+		Attribute{Key: AttributeFiles, Value: files},
+	)
+	return obs
+}
@@ -0,0 +1,323 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mithrandie/csvq/lib/parser"
+	"github.com/mithrandie/csvq/lib/query"
+)
+
+// DefaultWatchInterval is the interval at which a Watcher polls the files by default.
+const DefaultWatchInterval = time.Second
+
+// ChangeType is the type of a change to a watched file.
+type ChangeType int
+
+const (
+	// FileModified means that the modification time or the size of the file has changed.
+	FileModified ChangeType = iota
+	// FileReplaced means that the file has been replaced with another file, such as by renaming,
+	// or created again after it was deleted.
+	FileReplaced
+	// FileDeleted means that the file has been deleted.
+	FileDeleted
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case FileModified:
+		return "modified"
+	case FileReplaced:
+		return "replaced"
+	case FileDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// ChangeEvent is delivered by a Watcher when a file of a watched table changes.
+type ChangeEvent struct {
+	// Table is the table identifier in the query. Logical names of table aliases and names qualified by
+	// attached schemas are replaced with the paths of the files.
+	Table string
+	// Path is the path of the file. Files in the file system passed by WithFS are represented by their names in it.
+	Path string
+	Type ChangeType
+}
+
+type watchedFile struct {
+	table string
+	path  string
+	// osFile is true if the file is in the os file system, where replaced files can be identified.
+	osFile bool
+	stat   func() (fs.FileInfo, error)
+	info   fs.FileInfo
+}
+
+// poll returns the change of the file since the last call, or false if the file has not changed.
+func (f *watchedFile) poll() (ChangeType, bool) {
+	info, err := f.stat()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && f.info != nil {
+			f.info = nil
+			return FileDeleted, true
+		}
+		// Other errors are ignored so that temporary failures do not stop watching.
+		return 0, false
+	}
+
+	prev := f.info
+	f.info = info
+	switch {
+	case prev == nil:
+		return FileReplaced, true
+	case f.osFile && !os.SameFile(prev, info):
+		return FileReplaced, true
+	case newFileState(prev) != newFileState(info):
+		return FileModified, true
+	}
+	return 0, false
+}
+
+// Watcher polls the files of the tables that a query refers to, and delivers the changes to the channel returned by Events.
+type Watcher struct {
+	files    []*watchedFile
+	interval time.Duration
+	events   chan ChangeEvent
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Watch returns a Watcher that polls the files of the tables that the query refers to at the interval through the connection.
+// The query is not executed. The Watcher stops when the context is done or the Watcher is closed.
+func Watch(ctx context.Context, conn *sql.Conn, queryString string, interval time.Duration) (*Watcher, error) {
+	var w *Watcher
+	err := conn.Raw(func(driverConn interface{}) (err error) {
+		w, err = driverConn.(*Conn).Watch(ctx, queryString, interval)
+		return err
+	})
+	return w, err
+}
+
+// Watch returns a Watcher that polls the files of the tables that the query refers to at the interval.
+// If interval is not positive, DefaultWatchInterval is used.
+// The query is not executed, and the Watcher does not use the connection after it is returned.
+// The Watcher stops when the context is done or the Watcher is closed.
+func (c *Conn) Watch(ctx context.Context, queryString string, interval time.Duration) (*Watcher, error) {
+	if c.proc == nil {
+		return nil, driver.ErrBadConn
+	}
+
+	files, err := c.watchedFiles(queryString)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) < 1 {
+		return nil, errors.New("query does not refer to any files")
+	}
+
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watcher{
+		files:    files,
+		interval: interval,
+		events:   make(chan ChangeEvent, len(files)),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go w.run(ctx)
+	return w, nil
+}
+
+// Events returns the channel that the changes are delivered to. The channel is closed when the Watcher stops.
+func (w *Watcher) Events() <-chan ChangeEvent {
+	return w.events
+}
+
+// Close stops the Watcher and waits for the polling to finish.
+func (w *Watcher) Close() error {
+	w.once.Do(w.cancel)
+	<-w.done
+	return nil
+}
+
+func (w *Watcher) run(ctx context.Context) {
+	defer func() {
+		close(w.events)
+		close(w.done)
+	}()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, f := range w.files {
+			typ, changed := f.poll()
+			if !changed {
+				continue
+			}
+			select {
+			case w.events <- ChangeEvent{Table: f.table, Path: f.path, Type: typ}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// watchedFiles resolves the files of the tables that the query refers to.
+// Temporary tables, inline tables, table aliases and the tables of the information schema have no files and are not watched.
+// The other tables must refer to existing files.
+// Tables in archives and compressed files are watched as the archives and the compressed files.
+func (c *Conn) watchedFiles(queryString string) ([]*watchedFile, error) {
+	rewritten, _, err := c.rewritePlaceholders(queryString)
+	if err != nil {
+		return nil, err
+	}
+	rewritten = quoteQualifiedNames(rewritten, c.proc.Tx.Flags.AnsiQuotes, isInformationSchema)
+	rewritten = c.rewriteTableAliases(c.rewriteAttachedTables(rewritten))
+
+	statements, _, err := parser.Parse(rewritten, "", true, c.proc.Tx.Flags.AnsiQuotes)
+	if err != nil {
+		return nil, query.NewSyntaxError(err.(*parser.SyntaxError))
+	}
+	if err = c.checkSandbox(statements); err != nil {
+		return nil, err
+	}
+
+	repository, err := repositoryPath(c.proc.Tx.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	unwatched := unwatchedTables(statements)
+	aliases := aliasNames(statements)
+	var files []*watchedFile
+	watched := make(map[string]bool)
+	for _, table := range referencedTables(statements) {
+		if unwatched[strings.ToUpper(table)] || c.proc.ReferenceScope.TemporaryTableExists(table) || strings.HasPrefix(strings.ToLower(table), InformationSchema+".") {
+			continue
+		}
+
+		f, err := c.watchedFile(table, repository)
+		if err != nil {
+			// Tables of UPDATE and DELETE statements can be referred by their aliases.
+			if aliases[strings.ToUpper(table)] {
+				continue
+			}
+			return nil, err
+		}
+		if watched[f.path] {
+			continue
+		}
+		if f.info, err = f.stat(); err != nil {
+			return nil, err
+		}
+		watched[f.path] = true
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// unwatchedTables returns the upper-cased names that the statements define without files,
+// which are the names of inline tables and temporary tables declared in the statements.
+func unwatchedTables(statements []parser.Statement) map[string]bool {
+	names := make(map[string]bool)
+	walkStatements(statements, func(node interface{}) bool {
+		switch n := node.(type) {
+		case parser.InlineTable:
+			names[strings.ToUpper(n.Name.Literal)] = true
+		case parser.ViewDeclaration:
+			names[strings.ToUpper(n.View.Literal)] = true
+		}
+		return true
+	})
+	return names
+}
+
+// aliasNames returns the upper-cased aliases of the tables in the statements.
+// An alias can be the same as the name of a table file, so it is ignored only if it does not refer to a file.
+func aliasNames(statements []parser.Statement) map[string]bool {
+	names := make(map[string]bool)
+	walkStatements(statements, func(node interface{}) bool {
+		if n, ok := node.(parser.Table); ok {
+			if id, ok := n.Alias.(parser.Identifier); ok {
+				names[strings.ToUpper(id.Literal)] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+func (c *Conn) watchedFile(table string, repository string) (*watchedFile, error) {
+	name := table
+	archive, _, compressed := splitArchivePath(table)
+	if !compressed {
+		if _, _, ok := codecFor(table); ok {
+			archive, compressed = table, true
+		} else if c.compression != nil && isTableFile(table) && !c.sourceExists(table) {
+			archive, compressed = table+c.compression.Extensions[0], true
+		}
+	}
+	if compressed {
+		name = archive
+	}
+
+	if c.fs != nil && !filepath.IsAbs(name) {
+		resolved, ok := c.fs.resolve(name)
+		if !ok {
+			return nil, fmt.Errorf("file %s does not exist", table)
+		}
+		p := c.fs.fsPath(resolved)
+		fsys := c.fs.fsys
+		return &watchedFile{
+			table: table,
+			path:  p,
+			stat: func() (fs.FileInfo, error) {
+				return fs.Stat(fsys, p)
+			},
+		}, nil
+	}
+
+	var p string
+	if compressed {
+		var err error
+		if p, err = c.sourcePath(archive); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if p, err = query.SearchFilePathFromAllTypes(parser.Identifier{Literal: name}, repository); err != nil {
+			return nil, err
+		}
+	}
+	return &watchedFile{
+		table:  table,
+		path:   p,
+		osFile: true,
+		stat: func() (fs.FileInfo, error) {
+			return os.Stat(p)
+		},
+	}, nil
+}
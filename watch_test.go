@@ -0,0 +1,100 @@
+package csvq
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeoutForTests)
+	defer cancel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"modified.csv", "replaced.csv", "deleted.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("id,name\n1,str1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := sql.Open("csvq", dir)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := Watch(ctx, conn, "WITH t AS (SELECT 1) SELECT * FROM t", 0); err == nil || err.Error() != "query does not refer to any files" {
+		t.Errorf("error = %v, want error %q", err, "query does not refer to any files")
+	}
+	if _, err := Watch(ctx, conn, "SELECT * FROM missing", 0); err == nil || err.Error() != "file missing does not exist" {
+		t.Errorf("error = %v, want error %q", err, "file missing does not exist")
+	}
+	if w, err := Watch(ctx, conn, "UPDATE m SET name = 'str2' FROM modified AS m", 0); err != nil {
+		t.Errorf("unexpected error %q", err.Error())
+	} else {
+		_ = w.Close()
+	}
+
+	if w, err := Watch(ctx, conn, "SELECT * FROM modified AS modified", 0); err != nil {
+		t.Errorf("unexpected error %q", err.Error())
+	} else {
+		_ = w.Close()
+	}
+
+	w, err := Watch(ctx, conn, "SELECT * FROM modified m CROSS JOIN `replaced.csv` CROSS JOIN deleted WHERE m.id = ?", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+
+	receive := func(expect ChangeEvent) {
+		select {
+		case e := <-w.Events():
+			if e != expect {
+				t.Errorf("event = %v, want %v", e, expect)
+			}
+		case <-ctx.Done():
+			t.Fatalf("event %v is not delivered", expect)
+		}
+	}
+
+	p := filepath.Join(dir, "modified.csv")
+	if err := os.WriteFile(p, []byte("id,name\n1,str1\n2,str2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	receive(ChangeEvent{Table: "modified", Path: p, Type: FileModified})
+
+	p = filepath.Join(dir, "replaced.csv")
+	tmp := filepath.Join(dir, "replaced.tmp")
+	if err := os.WriteFile(tmp, []byte("id,name\n1,str1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		t.Fatal(err)
+	}
+	receive(ChangeEvent{Table: "replaced.csv", Path: p, Type: FileReplaced})
+
+	p = filepath.Join(dir, "deleted.csv")
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	receive(ChangeEvent{Table: "deleted", Path: p, Type: FileDeleted})
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error %q", err.Error())
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("channel is not closed")
+	}
+}